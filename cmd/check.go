@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xosmig/extsort/extsort"
+	sortio "github.com/xosmig/extsort/io"
+	"os"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check [file]",
+	Short: "Check that numbers are sorted",
+	Long: "Check that numbers are sorted in the order defined by --signed and --reverse.\n\n" +
+		"The file is read in the output format (see --output_format), so that the flags of the sort can be reused, " +
+		"or from the standard input if there is no file or it is \"-\". " +
+		"The exit code is 1 if the numbers are not sorted or not a permutation of the --permutation_of file, " +
+		"and 2 if the files cannot be read.",
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if linesMode || recordSize > 0 {
+			fmt.Fprintln(os.Stderr, "Only numbers can be checked")
+			os.Exit(2)
+		}
+		bufferSizeValues := bufferSize / sortio.SizeOfValue
+		if bufferSizeValues < 1 {
+			fmt.Fprintln(os.Stderr, "Too small buffer size")
+			os.Exit(2)
+		}
+		byteBuffer := sortio.NewUint64ByteBuf(bufferSizeValues)
+
+		format := outputFormatName()
+		if format == "delta_flate" {
+			// the encoding is stored in the header
+			format = "delta"
+		}
+		newReader := valuesReaderFunc(format, bufferSizeValues, byteBuffer)
+		if newReader == nil {
+			fmt.Fprintf(os.Stderr, "Unknown output format: %v\n", outputFormat)
+			os.Exit(2)
+		}
+		inputFile, err := openInput(inputPathsOrStdin(args)[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening file: %v\n", err)
+			os.Exit(2)
+		}
+		defer closeInput(inputFile)
+		r := newReader(inputFile)
+
+		result, err := extsort.CheckSorted(r, valuesOrder())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+
+		fmt.Printf("values: %v\n", result.Count)
+		if result.Sorted {
+			fmt.Println("sorted: yes")
+		} else {
+			fmt.Printf("sorted: no, the value %v at position %v follows %v\n",
+				formatValue(result.Value), result.Position, formatValue(result.Previous))
+		}
+		fmt.Printf("digest: %v\n", result.Digest)
+
+		permutation := true
+		if permutationOf != "" {
+			permutation = checkPermutation(result.Digest, bufferSizeValues, byteBuffer)
+		}
+
+		if !result.Sorted || !permutation {
+			os.Exit(1)
+		}
+	},
+}
+
+// checkPermutation compares the digest with the digest of the --permutation_of file
+func checkPermutation(digest extsort.Digest, bufferSizeValues int, byteBuffer []byte) bool {
+	newReader := valuesReaderFunc(inputFormatName(), bufferSizeValues, byteBuffer)
+	if newReader == nil {
+		fmt.Fprintf(os.Stderr, "Unknown input format: %v\n", inputFormat)
+		os.Exit(2)
+	}
+	inputFile, err := openInput(permutationOf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening file: %v\n", err)
+		os.Exit(2)
+	}
+	defer closeInput(inputFile)
+	r := newReader(inputFile)
+
+	inputDigest, err := extsort.ComputeDigest(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	if inputDigest == digest {
+		fmt.Println("permutation: yes")
+		return true
+	}
+	fmt.Printf("permutation: no, the input has %v values, digest: %v\n", inputDigest.Count, inputDigest)
+	return false
+}
+
+// formatValue formats the value like the values of the text format (see --text_base, --text_prefix and --signed)
+func formatValue(x uint64) string {
+	return string(textValuesFormat().AppendNumber(nil, x))
+}
+
+var permutationOf string
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"context"
+	"encoding/binary"
 	"fmt"
 	"github.com/pkg/profile"
 	"github.com/spf13/cobra"
@@ -9,12 +11,19 @@ import (
 	"github.com/xosmig/extsort/util"
 	"io"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 )
 
 var rootCmd = &cobra.Command{
-	Use:   "extsort [input_file] [output_file]",
+	Use:   "extsort [input_file] [output_file] | extsort [input_file...] -o output_file",
 	Short: "Sort numbers in text or binary format",
-	Args:  cobra.MaximumNArgs(2),
+	Long: "Sort numbers in text or binary format.\n\n" +
+		"The input files are concatenated, or merged with --merge. \"-\" stands for the standard input, " +
+		"which is also read if there are no input files.\nWithout --output, the second argument is the output file, " +
+		"and the standard output is used if there is no second argument.",
+	Args: cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		if enableMemoryProfiling {
 			defer profile.Start(profile.MemProfile).Stop()
@@ -41,45 +50,107 @@ var rootCmd = &cobra.Command{
 			profiler = util.NewSimpleProfiler()
 		}
 
-		var inputFile io.Reader
-		if len(args) >= 1 {
-			f, err := os.Open(args[0])
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error opening input file: %v\n", err)
-				os.Exit(1)
+		if (uniqueValues || countValues) && noSort {
+			fmt.Fprintln(os.Stderr, "--unique and --count cannot be used with --no_sort")
+			os.Exit(2)
+		}
+		if mergeInputs && (resumeCheckpoint != "" || noSort || firstStageOnly) {
+			fmt.Fprintln(os.Stderr, "--merge cannot be used with --resume, --no_sort or --first_stage_only")
+			os.Exit(2)
+		}
+
+		var inputPaths []string
+		outputPath := outputFlag
+		if resumeCheckpoint != "" {
+			// the input is not read when resuming
+			if len(args) > 1 || (outputPath != "" && len(args) > 0) {
+				fmt.Fprintln(os.Stderr, "The only argument of --resume is the output file")
+				os.Exit(2)
+			}
+			if noSort || firstStageOnly {
+				fmt.Fprintln(os.Stderr, "--resume cannot be used with --no_sort or --first_stage_only")
+				os.Exit(2)
+			}
+			if len(args) >= 1 {
+				outputPath = args[0]
 			}
-			defer f.Close()
-			inputFile = f
+		} else if outputPath != "" {
+			inputPaths = args
 		} else {
-			inputFile = os.Stdin
+			if len(args) > 2 {
+				fmt.Fprintln(os.Stderr, "Use --output to sort several input files")
+				os.Exit(2)
+			}
+			if len(args) >= 1 {
+				inputPaths = args[:1]
+			}
+			if len(args) >= 2 {
+				outputPath = args[1]
+			}
 		}
 
-		var input sortio.Uint64Reader
-		if textFormat || textInputFormat {
-			input = sortio.NewTextUint64ReaderCount(inputFile, bufferSizeValues)
-		} else {
-			input = sortio.NewBinaryUint64ReaderCountBuf(inputFile, bufferSizeValues, byteBuffer)
+		inputPaths = inputPathsOrStdin(inputPaths)
+		inputInfos, err := statInputs(inputPaths)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening input file: %v\n", err)
+			os.Exit(1)
 		}
-		input.SetProfiler(profiler)
 
-		var outputFile *os.File
-		if len(args) >= 2 {
-			f, err := os.Create(args[1])
+		// the output replaces the file only if the sort succeeds (see execute)
+		var outputFile *output
+		if outputPath != "" {
+			outputFile, err = openOutput(outputPath, inputInfos)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error opening output file: %v\n", err)
 				os.Exit(1)
 			}
-			defer f.Close()
-			outputFile = f
+			defer outputFile.Close()
 		} else {
-			outputFile = os.Stdout
+			outputFile = stdoutOutput()
+		}
+
+		if linesMode {
+			runLines(inputPaths, outputFile, profiler)
+			return
+		}
+
+		if recordSize > 0 {
+			runFixedRecords(inputPaths, outputFile, profiler)
+			return
+		}
+
+		// the readers share the byte buffer, since they only use it while filling their buffers of values
+		newReader := valuesReaderFunc(inputFormatName(), bufferSizeValues, byteBuffer)
+		if newReader == nil {
+			fmt.Fprintf(os.Stderr, "Unknown input format: %v\n", inputFormat)
+			os.Exit(2)
+		}
+		inputs := make([]sortio.Uint64Reader, len(inputPaths))
+		for i, path := range inputPaths {
+			inputs[i] = sortio.NewLazyUint64Reader(openLazily(path, newReader))
+			inputs[i].SetProfiler(profiler)
+		}
+		input := sortio.NewConcatUint64Reader(inputs...)
+
+		if countValues {
+			runCounts(input, outputFile, memoryLimitValues, bufferSizeValues, profiler)
+			return
 		}
 
 		var output sortio.Uint64Writer
-		if textFormat || textOutputFormat {
-			output = sortio.NewTextUint64WriterCount(outputFile, bufferSizeValues)
-		} else {
-			output = sortio.NewBinaryUint64WriterCountBuf(outputFile, bufferSizeValues, byteBuffer)
+		switch outputFormatName() {
+		case "binary":
+			output = sortio.NewBinaryUint64WriterCountBufOrder(outputFile.stream, bufferSizeValues, byteBuffer, byteOrder())
+		case "text":
+			output = sortio.NewTextUint64WriterCountFormat(outputFile.stream, bufferSizeValues, textValuesFormat())
+		case "delta":
+			output = sortio.NewDeltaUint64WriterCount(outputFile.headerStream(), bufferSizeValues, sortio.DeltaVarint)
+		case "delta_flate":
+			output = sortio.NewDeltaUint64WriterCount(outputFile.headerStream(), bufferSizeValues,
+				sortio.DeltaVarintFlate)
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown output format: %v\n", outputFormat)
+			os.Exit(2)
 		}
 		output.SetProfiler(profiler)
 
@@ -87,47 +158,591 @@ var rootCmd = &cobra.Command{
 			memoryLimitValues-3*bufferSizeValues,
 			bufferSizeValues,
 			useReplacementSelection)
+		params.Less = valuesOrder()
+		params.Stable = stable
+		params.Unique = uniqueValues
+		params.Parallelism = parallelism
+		params.Forecasting = forecasting
+		params.UseLoserTree = useLoserTree
+		params.InMemorySort = inMemorySortAlgorithm()
+		params.Compression = compressionFormat()
+		params.Checksums = checksums
+		params.Checkpoint = checkpointFile
+		setTmpFileIO(&params)
+		setTempDirs(&params)
 
-		run := func() error {
+		run := func(ctx context.Context) error {
+			if resumeCheckpoint != "" {
+				return extsort.ResumeMultiwayMergeSortParamsContext(ctx, resumeCheckpoint, output, params, profiler)
+			}
+			if mergeInputs {
+				return extsort.DoMultiwayMergeInputsParamsContext(ctx, inputs, output, params, profiler)
+			}
 			if firstStageOnly {
-				_, err := extsort.DoFirstStageParams(input, output, params)
+				_, err := extsort.DoFirstStageParamsContext(ctx, input, output, params)
 				return err
 			} else {
-				return extsort.DoMultiwayMergeSortParams(input, output, params, profiler)
+				return extsort.DoMultiwayMergeSortParamsContext(ctx, input, output, params, profiler)
 			}
 		}
 		if noSort {
-			run = func() error { return sortio.CopyValues(input, output) }
+			run = func(ctx context.Context) error { return sortio.CopyValues(input, output) }
 		}
 
-		profiler.Start()
-		err := run()
-		profiler.Finish()
+		execute(run, outputFile, profiler)
+	},
+}
+
+// setTmpFileIO sets AsyncIO requested by the flags and reserves the additional blocks of the temporary file written
+// by the first stage (see extsort.TmpFileBufferSize). It must be called after Checksums and Compression are set.
+func setTmpFileIO(params *extsort.Params) {
+	params.AsyncIO = asyncIO
+	params.FirstStageMemoryLimit -= extsort.TmpFileBufferSize(*params) - params.BufferSize
+}
 
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+// setTempDirs sets the temporary directories requested by the flags.
+// The library falls back to os.TempDir(), which respects TMPDIR, if no directories are given.
+func setTempDirs(params *extsort.Params) {
+	params.TempDirs = tmpDirs
+	switch tmpDirPolicy {
+	case "round_robin":
+		params.TempDirPolicy = extsort.RoundRobin
+	case "free_space":
+		params.TempDirPolicy = extsort.MostFreeSpace
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown temporary directory policy: %v\n", tmpDirPolicy)
+		os.Exit(2)
+	}
+}
+
+// valuesOrder returns the order of values requested by the flags or nil for the default order
+func valuesOrder() func(a, b uint64) bool {
+	if !signed && !reverse {
+		return nil
+	}
+
+	less := extsort.LessUnsigned
+	if signed {
+		less = extsort.LessSigned
+	}
+	if reverse {
+		less = extsort.Reverse(less)
+	}
+	return less
+}
+
+// inMemorySortAlgorithm returns the algorithm requested by the --in_memory_sort flag
+func inMemorySortAlgorithm() extsort.InMemorySort {
+	switch inMemorySort {
+	case "comparison":
+		return extsort.ComparisonSort
+	case "lsd":
+		return extsort.LSDRadixSort
+	case "msd":
+		return extsort.MSDRadixSort
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown in-memory sort algorithm: %v\n", inMemorySort)
+		os.Exit(2)
+		return extsort.ComparisonSort
+	}
+}
+
+// inputFormatName returns the format of the input requested by --input_format or the --text flags
+func inputFormatName() string {
+	return formatName("--input_format", inputFormat, textFormat || textInputFormat)
+}
+
+// outputFormatName returns the format of the output requested by --output_format or the --text flags
+func outputFormatName() string {
+	return formatName("--output_format", outputFormat, textFormat || textOutputFormat)
+}
+
+func formatName(flag string, format string, text bool) string {
+	if format == "" {
+		if text {
+			return "text"
 		}
+		return "binary"
+	}
+	if text && format != "text" {
+		fmt.Fprintf(os.Stderr, "%v=%v conflicts with the --text flags\n", flag, format)
+		os.Exit(2)
+	}
+	return format
+}
 
-		if !profiler.IsNilProfiler() {
-			fmt.Fprint(os.Stderr, "Profiling results:\n")
-			fmt.Fprintf(os.Stderr, "io time: %.2f seconds\n", float64(profiler.GetTotalMeasuredDuration().Nanoseconds())/1e9)
-			fmt.Fprintf(os.Stderr, "total time: %.2f seconds\n", float64(profiler.GetTotalRunningDuration().Nanoseconds())/1e9)
-			fmt.Fprintf(os.Stderr, "io time ratio: %.2f\n", profiler.GetMeasuredDurationRatio())
+// valuesReaderFunc returns a function, which creates a reader of values in the format (see --input_format),
+// or nil for an unknown format
+func valuesReaderFunc(format string, bufferSizeValues int, byteBuffer []byte) func(r io.Reader) sortio.Uint64Reader {
+	switch format {
+	case "binary":
+		order := byteOrder()
+		return func(r io.Reader) sortio.Uint64Reader {
+			return sortio.NewBinaryUint64ReaderCountBufOrder(r, bufferSizeValues, byteBuffer, order)
 		}
-	},
+	case "text":
+		textFormat := textValuesFormat()
+		return func(r io.Reader) sortio.Uint64Reader {
+			return sortio.NewTextUint64ReaderCountFormat(r, bufferSizeValues, textFormat)
+		}
+	case "delta":
+		return func(r io.Reader) sortio.Uint64Reader {
+			return sortio.NewDeltaUint64ReaderCount(r, bufferSizeValues)
+		}
+	default:
+		return nil
+	}
+}
+
+// syncPolicy returns the sync policy of the output requested by the --fsync flag
+func syncPolicy() sortio.SyncPolicy {
+	switch fsync {
+	case "never":
+		return sortio.SyncPolicy{Mode: sortio.SyncNever}
+	case "close":
+		return sortio.SyncPolicy{Mode: sortio.SyncOnClose}
+	case "flush":
+		return sortio.SyncPolicy{Mode: sortio.SyncEveryFlush}
+	}
+
+	bytes, err := strconv.ParseInt(fsync, 10, 64)
+	if err != nil || bytes < 1 {
+		fmt.Fprintf(os.Stderr, "Unknown fsync policy: %v\n", fsync)
+		os.Exit(2)
+	}
+	return sortio.SyncPolicy{Mode: sortio.SyncEveryBytes, Bytes: bytes}
+}
+
+// byteOrder returns the byte order of binary values requested by the --endian flag
+func byteOrder() binary.ByteOrder {
+	switch endian {
+	case "little":
+		return binary.LittleEndian
+	case "big":
+		return binary.BigEndian
+	case "native":
+		return binary.NativeEndian
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown byte order: %v\n", endian)
+		os.Exit(2)
+		return nil
+	}
+}
+
+// textDelimiters maps the names accepted by --text_delimiter and --text_input_delimiters to the delimiters
+var textDelimiters = map[string]byte{
+	"newline": '\n',
+	"space":   ' ',
+	"tab":     '\t',
+	"comma":   ',',
+	"nul":     0,
+}
+
+func textDelimiter(name string) byte {
+	delimiter, ok := textDelimiters[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown text delimiter: %v\n", name)
+		os.Exit(2)
+	}
+	return delimiter
+}
+
+// textValuesFormat returns the text format requested by the --text_* flags
+func textValuesFormat() sortio.TextFormat {
+	format := sortio.DefaultTextFormat()
+	format.Delimiter = textDelimiter(textDelimiterName)
+	for _, name := range textInputDelimiterNames {
+		format.InputDelimiters += string(textDelimiter(name))
+	}
+	format.Strict = textStrict
+	format.Signed = signed
+	format.Base = textBase
+	format.Prefix = textPrefix
+
+	if err := format.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Unsupported base of text values: %v\n", textBase)
+		os.Exit(2)
+	}
+	return format
+}
+
+// compressionFormat returns the format of the temporary files requested by the --compression flag
+func compressionFormat() extsort.Compression {
+	switch compression {
+	case "none":
+		return extsort.NoCompression
+	case "delta":
+		return extsort.DeltaCompression
+	case "flate":
+		return extsort.FlateCompression
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown compression: %v\n", compression)
+		os.Exit(2)
+		return extsort.NoCompression
+	}
+}
+
+// runLines sorts newline-delimited records lexicographically
+func runLines(inputPaths []string, outputFile *output, profiler *util.SimpleProfiler) {
+	if useReplacementSelection {
+		fmt.Fprintln(os.Stderr, "Replacement selection is not supported in lines mode")
+		os.Exit(2)
+	}
+	if signed {
+		fmt.Fprintln(os.Stderr, "Signed order is not supported in lines mode")
+		os.Exit(2)
+	}
+	if inMemorySortAlgorithm() != extsort.ComparisonSort {
+		fmt.Fprintln(os.Stderr, "Radix sort is not supported in lines mode")
+		os.Exit(2)
+	}
+	if compressionFormat() != extsort.NoCompression {
+		fmt.Fprintln(os.Stderr, "Compression is not supported in lines mode")
+		os.Exit(2)
+	}
+	if inputFormat != "" || outputFormat != "" {
+		fmt.Fprintln(os.Stderr, "--input_format and --output_format are not supported in lines mode")
+		os.Exit(2)
+	}
+	if endian != "little" {
+		fmt.Fprintln(os.Stderr, "--endian is not supported in lines mode")
+		os.Exit(2)
+	}
+	if countValues {
+		fmt.Fprintln(os.Stderr, "--count is not supported in lines mode")
+		os.Exit(2)
+	}
+	if uniqueValues && firstStageOnly {
+		fmt.Fprintln(os.Stderr, "--unique cannot be used with --first_stage_only in lines mode")
+		os.Exit(2)
+	}
+
+	newReader := func(r io.Reader) sortio.Reader[[]byte] { return sortio.NewLineReaderSize(r, bufferSize) }
+	inputs := make([]sortio.Reader[[]byte], len(inputPaths))
+	for i, path := range inputPaths {
+		inputs[i] = sortio.NewLazyReader(openLazily(path, newReader))
+		inputs[i].SetProfiler(profiler)
+	}
+	input := sortio.NewConcatReader(inputs...)
+	output := sortio.NewLineWriterSize(outputFile.stream, bufferSize)
+	output.SetProfiler(profiler)
+
+	// in lines mode all the parameters are expressed in bytes
+	// reserve 10% of memory for go runtime
+	memoryLimitBytes := (memoryLimit * 9) / 10
+	params := extsort.CreateParams(memoryLimitBytes-3*bufferSize, bufferSize, false)
+	params.Stable = stable
+	params.Unique = uniqueValues
+	params.UseLoserTree = useLoserTree
+	params.Checksums = checksums
+	params.Checkpoint = checkpointFile
+	setTmpFileIO(&params)
+	setTempDirs(&params)
+
+	less := extsort.LessBytes
+	if reverse {
+		less = extsort.Reverse(less)
+	}
+
+	run := func(ctx context.Context) error {
+		if resumeCheckpoint != "" {
+			return extsort.ResumeMultiwayMergeSortRecordsContext(ctx, resumeCheckpoint, output, less, params, profiler)
+		}
+		if mergeInputs {
+			return extsort.DoMultiwayMergeInputsRecordsContext(ctx, inputs, output, less, params, profiler)
+		}
+		if firstStageOnly {
+			_, err := extsort.DoInitialSortRecords(input, output, less,
+				params.FirstStageMemoryLimit, params.ReserveMemoryForSegmentsInfo)
+			return err
+		} else {
+			return extsort.DoMultiwayMergeSortRecordsContext(ctx, input, output, less, params, profiler)
+		}
+	}
+	if noSort {
+		run = func(ctx context.Context) error { return sortio.Copy[[]byte](input, output) }
+	}
+
+	execute(run, outputFile, profiler)
+}
+
+// runFixedRecords sorts fixed-width binary records by the configured key
+func runFixedRecords(inputPaths []string, outputFile *output, profiler *util.SimpleProfiler) {
+	format := sortio.FixedRecordFormat{
+		Size:      recordSize,
+		KeyOffset: keyOffset,
+		KeyLength: keyLength,
+		ByteOrder: byteOrder(),
+	}
+	switch keyType {
+	case "bytes":
+		format.KeyType = sortio.KeyBytes
+	case "uint64":
+		format.KeyType = sortio.KeyUint64
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown key type: %v\n", keyType)
+		os.Exit(2)
+	}
+	if err := format.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if signed {
+		fmt.Fprintln(os.Stderr, "Signed order is not supported for fixed-width records")
+		os.Exit(2)
+	}
+	if inMemorySortAlgorithm() != extsort.ComparisonSort {
+		fmt.Fprintln(os.Stderr, "Radix sort is not supported for fixed-width records")
+		os.Exit(2)
+	}
+	if compressionFormat() != extsort.NoCompression {
+		fmt.Fprintln(os.Stderr, "Compression is not supported for fixed-width records")
+		os.Exit(2)
+	}
+	if textFormat || textInputFormat || textOutputFormat {
+		fmt.Fprintln(os.Stderr, "Text format is not supported for fixed-width records")
+		os.Exit(2)
+	}
+	if inputFormat != "" || outputFormat != "" {
+		fmt.Fprintln(os.Stderr, "--input_format and --output_format are not supported for fixed-width records")
+		os.Exit(2)
+	}
+	if countValues {
+		fmt.Fprintln(os.Stderr, "--count is not supported for fixed-width records")
+		os.Exit(2)
+	}
+
+	bufferSizeRecords := bufferSize / recordSize
+	if bufferSizeRecords < 1 {
+		fmt.Fprintln(os.Stderr, "Too small buffer size")
+		os.Exit(2)
+	}
+	// reserve 10% of memory for go runtime
+	memoryLimitRecords := (memoryLimit / extsort.FixedRecordMemory(recordSize) * 9) / 10
+
+	codec := format.Codec()
+	byteBuffer := sortio.NewByteBuf[[]byte](codec, bufferSizeRecords)
+	newReader := func(r io.Reader) sortio.Reader[[]byte] {
+		return sortio.NewBinaryReaderCountBuf[[]byte](r, codec, bufferSizeRecords, byteBuffer)
+	}
+	inputs := make([]sortio.Reader[[]byte], len(inputPaths))
+	for i, path := range inputPaths {
+		inputs[i] = sortio.NewLazyReader(openLazily(path, newReader))
+		inputs[i].SetProfiler(profiler)
+	}
+	input := sortio.NewConcatReader(inputs...)
+	output := sortio.NewBinaryWriterCountBuf[[]byte](outputFile.stream, codec, bufferSizeRecords, byteBuffer)
+	output.SetProfiler(profiler)
+
+	params := extsort.CreateParams(
+		memoryLimitRecords-3*bufferSizeRecords,
+		bufferSizeRecords,
+		useReplacementSelection)
+	params.Stable = stable
+	params.Unique = uniqueValues
+	params.Parallelism = parallelism
+	params.Forecasting = forecasting
+	params.UseLoserTree = useLoserTree
+	params.Checksums = checksums
+	params.Checkpoint = checkpointFile
+	setTmpFileIO(&params)
+	setTempDirs(&params)
+
+	less := extsort.FixedRecordLess(format)
+	if reverse {
+		less = extsort.Reverse(less)
+	}
+
+	run := func(ctx context.Context) error {
+		if resumeCheckpoint != "" {
+			return extsort.ResumeMultiwayMergeSortFuncContext[[]byte](
+				ctx, resumeCheckpoint, output, codec, less, params, profiler)
+		}
+		if mergeInputs {
+			return extsort.DoMultiwayMergeInputsFuncContext[[]byte](ctx, inputs, output, codec, less, params, profiler)
+		}
+		if firstStageOnly {
+			_, err := extsort.DoFirstStageParamsFuncContext[[]byte](ctx, input, output, less, params)
+			return err
+		} else {
+			return extsort.DoMultiwayMergeSortFuncContext[[]byte](ctx, input, output, format.Codec(), less, params, profiler)
+		}
+	}
+	if noSort {
+		run = func(ctx context.Context) error { return sortio.Copy[[]byte](input, output) }
+	}
+
+	execute(run, outputFile, profiler)
+}
+
+// runCounts sorts the distinct numbers and writes every number along with the number of its occurrences
+func runCounts(input sortio.Uint64Reader, outputFile *output, memoryLimitValues, bufferSizeValues int,
+	profiler *util.SimpleProfiler) {
+
+	if mergeInputs || firstStageOnly {
+		fmt.Fprintln(os.Stderr, "--count cannot be used with --merge or --first_stage_only")
+		os.Exit(2)
+	}
+	if compressionFormat() != extsort.NoCompression {
+		fmt.Fprintln(os.Stderr, "Compression is not supported with --count")
+		os.Exit(2)
+	}
+
+	// the numbers are sorted along with their counts, so all the parameters are expressed in pairs
+	bufferSizePairs := bufferSizeValues / 2
+	if bufferSizePairs < 1 {
+		fmt.Fprintln(os.Stderr, "Too small buffer size")
+		os.Exit(2)
+	}
+
+	var output sortio.Writer[sortio.ValueCount]
+	switch outputFormatName() {
+	case "binary":
+		codec := sortio.ValueCountCodec{ByteOrder: byteOrder()}
+		output = sortio.NewBinaryWriterCountBuf[sortio.ValueCount](outputFile.stream, codec, bufferSizePairs,
+			sortio.NewByteBuf[sortio.ValueCount](codec, bufferSizePairs))
+	case "text":
+		output = sortio.NewTextValueCountWriterCountFormat(outputFile.stream, bufferSizeValues, textValuesFormat())
+	default:
+		fmt.Fprintf(os.Stderr, "Output format %v is not supported with --count\n", outputFormatName())
+		os.Exit(2)
+	}
+	output.SetProfiler(profiler)
+
+	params := extsort.CreateParams(
+		(memoryLimitValues-3*bufferSizeValues)/2,
+		bufferSizePairs,
+		useReplacementSelection)
+	params.Less = valuesOrder()
+	params.Parallelism = parallelism
+	params.Forecasting = forecasting
+	params.UseLoserTree = useLoserTree
+	params.InMemorySort = inMemorySortAlgorithm()
+	params.Checksums = checksums
+	params.Checkpoint = checkpointFile
+	setTmpFileIO(&params)
+	setTempDirs(&params)
+
+	run := func(ctx context.Context) error {
+		if resumeCheckpoint != "" {
+			return extsort.ResumeMultiwayMergeSortCountsContext(ctx, resumeCheckpoint, output, params, profiler)
+		}
+		return extsort.DoMultiwayMergeSortCountsContext(ctx, input, output, params, profiler)
+	}
+
+	execute(run, outputFile, profiler)
+}
+
+func runWithCleanup(ctx context.Context, run func(ctx context.Context) error) error {
+	defer extsort.CleanupOnPanic()
+	return run(ctx)
+}
+
+// execute runs the sort making sure that the temporary files are removed
+// if the process is interrupted, panics or exits with an error.
+// SIGINT cancels the sort gracefully, while the second SIGINT and SIGTERM terminate the process immediately.
+// The output is committed after the sort, so that it is synced according to --fsync and replaces the output file.
+func execute(run func(ctx context.Context) error, outputFile *output, profiler *util.SimpleProfiler) {
+	stopCleanup := extsort.CleanupOnSignals(syscall.SIGTERM)
+	defer stopCleanup()
+
+	ctx, stopNotify := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stopNotify()
+	go func() {
+		<-ctx.Done()
+		// the second SIGINT does not wait for the sorting to stop
+		stopNotify()
+		extsort.CleanupOnSignals(os.Interrupt, syscall.SIGTERM)
+	}()
+
+	profiler.Start()
+	err := runWithCleanup(ctx, run)
+	if err == nil {
+		err = outputFile.Commit()
+	}
+	profiler.Finish()
+
+	// the temporary files are removed before the messages, since writing to a closed stderr kills the process
+	if ctx.Err() != nil && err == ctx.Err() {
+		extsort.RemoveTemporaryFiles()
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		printResumeHint()
+		os.Exit(130)
+	}
+	if err != nil {
+		extsort.RemoveTemporaryFiles()
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printResumeHint()
+		os.Exit(1)
+	}
+
+	if !profiler.IsNilProfiler() {
+		fmt.Fprint(os.Stderr, "Profiling results:\n")
+		fmt.Fprintf(os.Stderr, "io time: %.2f seconds\n", float64(profiler.GetTotalMeasuredDuration().Nanoseconds())/1e9)
+		fmt.Fprintf(os.Stderr, "total time: %.2f seconds\n", float64(profiler.GetTotalRunningDuration().Nanoseconds())/1e9)
+		fmt.Fprintf(os.Stderr, "io time ratio: %.2f\n", profiler.GetMeasuredDurationRatio())
+		if ratio := profiler.GetCompressionRatio(); ratio > 0 {
+			fmt.Fprintf(os.Stderr, "compression ratio: %.2f\n", ratio)
+		}
+	}
+}
+
+// printResumeHint tells how to resume the failed sort if a checkpoint was saved
+func printResumeHint() {
+	checkpoint := checkpointFile
+	if resumeCheckpoint != "" {
+		checkpoint = resumeCheckpoint
+	}
+	if checkpoint == "" {
+		return
+	}
+	if _, err := os.Stat(checkpoint); err == nil {
+		fmt.Fprintf(os.Stderr, "The sort can be resumed with --resume %v\n", checkpoint)
+	}
 }
 
 var memoryLimit int
 var textFormat bool
 var textInputFormat bool
 var textOutputFormat bool
+var textDelimiterName string
+var textInputDelimiterNames []string
+var textStrict bool
+var textBase int
+var textPrefix bool
+var inputFormat string
+var endian string
+var fsync string
+var outputFormat string
 var useReplacementSelection bool
 var noSort bool
 var bufferSize int
 var disableProfiling bool
 var enableMemoryProfiling bool
 var firstStageOnly bool
+var linesMode bool
+var recordSize int
+var keyOffset int
+var keyLength int
+var keyType string
+var reverse bool
+var signed bool
+var stable bool
+var parallelism int
+var asyncIO bool
+var forecasting bool
+var useLoserTree bool
+var inMemorySort string
+var tmpDirs []string
+var tmpDirPolicy string
+var compression string
+var checksums bool
+var checkpointFile string
+var resumeCheckpoint string
+var outputFlag string
+var mergeInputs bool
+var uniqueValues bool
+var countValues bool
 
 func Execute() {
 	rootCmd.PersistentFlags().IntVar(&memoryLimit, "ml", 1024*1024*1024, "Memory limit (in bytes).")
@@ -135,6 +750,30 @@ func Execute() {
 	rootCmd.PersistentFlags().BoolVar(&textFormat, "text", false, "Use textual format.")
 	rootCmd.PersistentFlags().BoolVar(&textInputFormat, "text_input", false, "Use textual input format.")
 	rootCmd.PersistentFlags().BoolVar(&textOutputFormat, "text_output", false, "Use textual output format.")
+	rootCmd.PersistentFlags().StringVar(&textDelimiterName, "text_delimiter",
+		"newline", "Delimiter written after every value in textual format: newline, space, tab, comma or nul.")
+	rootCmd.PersistentFlags().StringSliceVar(&textInputDelimiterNames, "text_input_delimiters",
+		nil, "Comma-separated delimiters of values in textual input (see --text_delimiter). "+
+			"Defaults to --text_delimiter, which is also accepted along with whitespace without --text_strict.")
+	rootCmd.PersistentFlags().BoolVar(&textStrict, "text_strict",
+		false, "Require exactly one delimiter after every value in textual input, so that empty values and "+
+			"extra whitespace are errors.")
+	rootCmd.PersistentFlags().IntVar(&textBase, "text_base",
+		10, "Base of values in textual format: 2, 8, 10 or 16. With --signed, negative values have a minus sign.")
+	rootCmd.PersistentFlags().BoolVar(&textPrefix, "text_prefix",
+		false, "Write 0b, 0o or 0x before values in base 2, 8 or 16. The prefixes are always accepted in the input.")
+	rootCmd.PersistentFlags().StringVar(&fsync, "fsync",
+		"close", "When the output is synced to the disk: never, close (once at the end), flush (after every buffer) "+
+			"or a number of bytes written between the syncs. Temporary files are only synced for --checkpoint.")
+	rootCmd.PersistentFlags().StringVar(&endian, "endian",
+		"little", "Byte order of values in binary format and of uint64 record keys: little, big or native. "+
+			"Temporary files always use the native byte order.")
+	rootCmd.PersistentFlags().StringVar(&inputFormat, "input_format",
+		"", "Format of the input: binary, text or delta (the compact format of sorted values written by "+
+			"--output_format=delta). Defaults to binary unless --text or --text_input is set.")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output_format",
+		"", "Format of the output: binary, text, delta (delta encoding and varints with a header) "+
+			"or delta_flate (delta and flate). Defaults to binary unless --text or --text_output is set.")
 	rootCmd.PersistentFlags().BoolVar(&useReplacementSelection, "replacement_selection",
 		false, "Use replacement selection algorithm.")
 	rootCmd.PersistentFlags().BoolVar(&disableProfiling, "no_prof", false, "Disable io profiling.")
@@ -144,6 +783,64 @@ func Execute() {
 		false, "Enable memory profiling.")
 	rootCmd.PersistentFlags().BoolVar(&firstStageOnly, "first_stage_only",
 		false, "Run only the first stage of sorting.")
+	rootCmd.PersistentFlags().BoolVar(&linesMode, "lines",
+		false, "Sort newline-delimited lines lexicographically instead of numbers.")
+	rootCmd.PersistentFlags().BoolVar(&reverse, "reverse", false, "Sort in descending order.")
+	rootCmd.PersistentFlags().BoolVar(&signed, "signed",
+		false, "Interpret values as signed (two's complement) integers.")
+	rootCmd.PersistentFlags().BoolVar(&stable, "stable",
+		false, "Preserve the input order of values with equal keys.")
+	rootCmd.PersistentFlags().BoolVar(&uniqueValues, "unique",
+		false, "Output only the first of equal values. The duplicates are also dropped from the temporary files.")
+	rootCmd.PersistentFlags().BoolVar(&countValues, "count",
+		false, "Output every distinct number followed by the number of its occurrences. "+
+			"In binary format, the counts are 8-byte numbers. Only supported for numbers.")
+	rootCmd.PersistentFlags().IntVar(&parallelism, "parallel",
+		1, "Number of chunks sorted concurrently during the first stage.")
+	rootCmd.PersistentFlags().BoolVar(&asyncIO, "async_io",
+		false, "Read and write temporary files on background goroutines with double buffering.")
+	rootCmd.PersistentFlags().BoolVar(&forecasting, "forecasting",
+		false, "Prefetch the block of the run, which will be exhausted first, during merges.")
+	rootCmd.PersistentFlags().BoolVar(&useLoserTree, "loser_tree",
+		false, "Use a loser tree instead of a heap for merges.")
+	rootCmd.PersistentFlags().StringVar(&inMemorySort, "in_memory_sort",
+		"comparison", "Algorithm used to sort chunks in memory: comparison, lsd (radix) or msd (radix). "+
+			"The radix sorts only support unsigned numbers in ascending order.")
+	rootCmd.PersistentFlags().StringArrayVar(&tmpDirs, "tmpdir",
+		nil, "Directory for temporary files. Can be repeated to distribute the files across several disks. "+
+			"Defaults to $TMPDIR or /tmp.")
+	rootCmd.PersistentFlags().StringVar(&tmpDirPolicy, "tmpdir_policy",
+		"round_robin", "How temporary files are distributed across the directories: round_robin or free_space.")
+	rootCmd.PersistentFlags().StringVar(&compression, "compression",
+		"none", "Format of temporary files: none, delta (delta encoding and varints) or flate (delta and flate). "+
+			"Only supported for numbers.")
+	rootCmd.PersistentFlags().BoolVar(&checksums, "checksums",
+		false, "Store CRC32C checksums in temporary files and verify them when the files are read.")
+	rootCmd.PersistentFlags().StringVar(&checkpointFile, "checkpoint",
+		"", "Save the state of the sort to the file after the first stage and every merge, "+
+			"so that a failed sort can be continued with --resume.")
+	rootCmd.PersistentFlags().StringVar(&resumeCheckpoint, "resume",
+		"", "Continue the sort from the checkpoint file. The input is not read, "+
+			"so the only argument is the output file. The order flags must match the interrupted sort.")
+	rootCmd.PersistentFlags().StringVarP(&outputFlag, "output", "o",
+		"", "Output file. All the arguments are input files if it is set.")
+	rootCmd.PersistentFlags().BoolVar(&mergeInputs, "merge",
+		false, "Merge the input files, which are already sorted, instead of sorting their concatenation. "+
+			"The files are merged in several passes through temporary files if there are too many of them.")
+	rootCmd.PersistentFlags().IntVar(&recordSize, "record_size",
+		0, "Sort fixed-width binary records of the given size (in bytes) instead of numbers.")
+	rootCmd.PersistentFlags().IntVar(&keyOffset, "key_offset",
+		0, "Offset of the sort key within a record (in bytes). Used with --record_size.")
+	rootCmd.PersistentFlags().IntVar(&keyLength, "key_length",
+		8, "Length of the sort key (in bytes). Used with --record_size.")
+	rootCmd.PersistentFlags().StringVar(&keyType, "key_type",
+		"bytes", "Type of the sort key: bytes (lexicographic) or uint64 (read in the --endian byte order). "+
+			"Used with --record_size.")
+
+	checkCmd.Flags().StringVar(&permutationOf, "permutation_of",
+		"", "Also check that the values are a permutation of the values of the file, "+
+			"which is read in the input format (see --input_format).")
+	rootCmd.AddCommand(checkCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
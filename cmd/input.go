@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"io"
+	"os"
+)
+
+// openInput opens the input file. "-" stands for the standard input.
+func openInput(path string) (*os.File, error) {
+	if path == "-" {
+		return os.Stdin, nil
+	}
+	return os.Open(path)
+}
+
+func closeInput(f *os.File) {
+	if f != os.Stdin {
+		f.Close()
+	}
+}
+
+// inputPathsOrStdin returns the standard input as the only input if there are no paths
+func inputPathsOrStdin(paths []string) []string {
+	if len(paths) == 0 {
+		return []string{"-"}
+	}
+	return paths
+}
+
+// statInputs returns the information about the input files, which is used to detect the sort of a file in place.
+// The inputs are only opened when they are read (see openLazily), so the missing files are also reported here
+// before the sort starts.
+func statInputs(paths []string) ([]os.FileInfo, error) {
+	infos := make([]os.FileInfo, len(paths))
+	for i, path := range paths {
+		var err error
+		if path == "-" {
+			infos[i], err = os.Stdin.Stat()
+		} else {
+			infos[i], err = os.Stat(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+// openLazily returns a function, which opens the input and creates a reader of it (see sortio.LazyReader).
+// The inputs are opened one at a time when they are concatenated, and a group at a time when they are merged,
+// so that a lot of inputs neither exhaust the file descriptors nor allocate all of their buffers at once.
+func openLazily[R any](path string, newReader func(r io.Reader) R) func() (R, io.Closer, error) {
+	return func() (R, io.Closer, error) {
+		f, err := openInput(path)
+		if err != nil {
+			var zero R
+			return zero, nil, err
+		}
+		if f == os.Stdin {
+			return newReader(f), nil, nil
+		}
+		return newReader(f), f, nil
+	}
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xosmig/extsort/extsort"
+	sortio "github.com/xosmig/extsort/io"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// output is the destination of the sorted values.
+// A regular file is written to a temporary file in the same directory, which replaces the file only when
+// the sort succeeds (see Commit). So the old content is kept if the sort fails, and a file can be sorted in place,
+// since the input is read from the original file until the end.
+type output struct {
+	file    *os.File
+	stream  *sortio.SyncWriter
+	path    string
+	tmpPath string
+}
+
+// stdoutOutput writes to the standard output
+func stdoutOutput() *output {
+	return &output{
+		file:   os.Stdout,
+		stream: sortio.NewSyncWriter(os.Stdout, syncPolicy()),
+	}
+}
+
+// openOutput opens the output file. The information about the inputs is used to detect the sort of a file in place.
+func openOutput(path string, inputs []os.FileInfo) (*output, error) {
+	// the target of a symlink is replaced rather than the symlink itself
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	inPlace := false
+	for _, input := range inputs {
+		if info != nil && os.SameFile(info, input) {
+			inPlace = true
+		}
+	}
+
+	if info != nil && !info.Mode().IsRegular() {
+		// devices and pipes cannot be replaced
+		if inPlace {
+			return nil, errors.New("cannot sort in place a file, which is not a regular file")
+		}
+		return openOutputDirectly(path)
+	}
+
+	// the file is not truncated if the directory is not writable, since the old content would be lost
+	// before the sort succeeds
+	f, tmpPath, err := createSibling(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create a temporary file next to the output: %w", err)
+	}
+	if info != nil {
+		// keep the permissions of the replaced file
+		if err := f.Chmod(info.Mode().Perm()); err != nil {
+			f.Close()
+			os.Remove(tmpPath)
+			return nil, err
+		}
+	}
+	extsort.RegisterTemporaryFile(tmpPath)
+
+	return &output{
+		file:    f,
+		stream:  sortio.NewSyncWriter(f, syncPolicy()),
+		path:    path,
+		tmpPath: tmpPath,
+	}, nil
+}
+
+func openOutputDirectly(path string) (*output, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &output{
+		file:   f,
+		stream: sortio.NewSyncWriter(f, syncPolicy()),
+		path:   path,
+	}, nil
+}
+
+// createSibling creates a new file in the directory of the path.
+// The permissions are the same as of os.Create, so that the umask is applied.
+func createSibling(path string) (*os.File, string, error) {
+	dir, base := filepath.Split(path)
+	for {
+		tmpPath := filepath.Join(dir, fmt.Sprintf(".%v.tmp%v", base, rand.Uint32()))
+		f, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, tmpPath, err
+	}
+}
+
+// streamOnly hides the Seek and WriteAt methods of the stream
+type streamOnly struct {
+	sortio.WriteSyncer
+}
+
+// headerStream returns the stream for the formats, which write a header and complete it at the end
+// (see sortio.DeltaUint64Writer). Only the temporary file opened by the command is written at an offset,
+// since the offsets of the other outputs may not be honored (e.g. the standard output redirected by >>).
+func (o *output) headerStream() sortio.WriteSyncer {
+	if o.tmpPath == "" {
+		return streamOnly{o.stream}
+	}
+	return o.stream
+}
+
+// Commit syncs the output according to --fsync and replaces the output file with the temporary file
+func (o *output) Commit() error {
+	if err := o.stream.Close(); err != nil {
+		return err
+	}
+	if o.file == os.Stdout {
+		return nil
+	}
+	if err := o.file.Close(); err != nil {
+		return err
+	}
+	if o.tmpPath == "" {
+		return nil
+	}
+
+	if err := os.Rename(o.tmpPath, o.path); err != nil {
+		return err
+	}
+	extsort.ForgetTemporaryFile(o.tmpPath)
+	o.tmpPath = ""
+	if syncPolicy().Mode != sortio.SyncNever {
+		// the rename is durable only when the directory is synced
+		return syncDir(filepath.Dir(o.path))
+	}
+	return nil
+}
+
+// Close closes the output file and removes the temporary file if Commit has not succeeded
+func (o *output) Close() {
+	if o.file == os.Stdout {
+		return
+	}
+	o.file.Close()
+	if o.tmpPath != "" {
+		os.Remove(o.tmpPath)
+		extsort.ForgetTemporaryFile(o.tmpPath)
+	}
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,112 @@
+package extsort
+
+import (
+	"fmt"
+	sortio "github.com/xosmig/extsort/io"
+	"hash/fnv"
+	"io"
+)
+
+// Digest is an order-independent digest of a sequence of values. The permutations of the same values have
+// equal digests, while different multisets of values have different digests with high probability.
+type Digest struct {
+	Count uint64
+	// Sum is the sum of the mixed hashes of the values, which does not depend on their order
+	Sum uint64
+}
+
+// Add adds a value with the given hash to the digest. The hash does not need to be well-distributed,
+// since it is mixed before it is added.
+func (d *Digest) Add(hash uint64) {
+	// the finalizer of splitmix64, which is a bijection
+	hash ^= hash >> 30
+	hash *= 0xbf58476d1ce4e5b9
+	hash ^= hash >> 27
+	hash *= 0x94d049bb133111eb
+	hash ^= hash >> 31
+
+	d.Count++
+	d.Sum += hash
+}
+
+func (d Digest) String() string {
+	return fmt.Sprintf("%016x%016x", d.Count, d.Sum)
+}
+
+// HashBytes can be used as the hash of variable-length records and byte keys by CheckSortedFunc
+func HashBytes(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+// CheckResult describes the order of the values read by CheckSorted
+type CheckResult[T any] struct {
+	// Count is the number of values read
+	Count uint64
+	// Sorted is false if a value is less than the previous one
+	Sorted bool
+	// Position is the index of the first value, which is less than the previous one.
+	// Position, Previous and Value are only set if the values are not sorted.
+	Position uint64
+	Previous T
+	Value    T
+	// Digest is the digest of all the values, which is equal to the digest of the input of the sort
+	// if the values are its permutation (see ComputeDigest).
+	Digest Digest
+}
+
+// CheckSorted reads all the values and checks that they are sorted in the order defined by less.
+// The ascending order is used if less is nil (see Params.Less).
+func CheckSorted(r sortio.Uint64Reader, less func(a, b uint64) bool) (CheckResult[uint64], error) {
+	if less == nil {
+		less = LessUnsigned
+	}
+	return CheckSortedFunc(sortio.AsReader(r), less, func(x uint64) uint64 { return x })
+}
+
+// CheckSortedFunc is a generic counterpart of CheckSorted. The hash of the values is used for the digest.
+func CheckSortedFunc[T any](r sortio.Reader[T], less func(a, b T) bool, hash func(x T) uint64) (CheckResult[T], error) {
+	result := CheckResult[T]{Sorted: true}
+	var previous T
+	for {
+		x, err := r.Read()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+
+		if result.Count > 0 && result.Sorted && less(x, previous) {
+			result.Sorted = false
+			result.Position = result.Count
+			result.Previous = previous
+			result.Value = x
+		}
+		result.Digest.Add(hash(x))
+		result.Count++
+		previous = x
+	}
+}
+
+// ComputeDigest returns the digest of the values, which can be compared with CheckResult.Digest
+// to check that the output of the sort is a permutation of the input.
+func ComputeDigest(r sortio.Uint64Reader) (Digest, error) {
+	return ComputeDigestFunc(sortio.AsReader(r), func(x uint64) uint64 { return x })
+}
+
+// ComputeDigestFunc is a generic counterpart of ComputeDigest.
+func ComputeDigestFunc[T any](r sortio.Reader[T], hash func(x T) uint64) (Digest, error) {
+	var digest Digest
+	for {
+		x, err := r.Read()
+		if err == io.EOF {
+			return digest, nil
+		}
+		if err != nil {
+			return digest, err
+		}
+		digest.Add(hash(x))
+	}
+}
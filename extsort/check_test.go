@@ -0,0 +1,107 @@
+package extsort
+
+import (
+	sortio "github.com/xosmig/extsort/io"
+	"strings"
+	"testing"
+)
+
+func TestCheckSorted(t *testing.T) {
+	testcases := []struct {
+		name     string
+		input    []uint64
+		less     func(a, b uint64) bool
+		sorted   bool
+		position uint64
+		previous uint64
+		value    uint64
+	}{
+		{"empty", nil, nil, true, 0, 0, 0},
+		{"single", []uint64{5}, nil, true, 0, 0, 0},
+		{"sorted", []uint64{1, 2, 2, 3, 1 << 63}, nil, true, 0, 0, 0},
+		{"unsorted", []uint64{1, 5, 3, 2}, nil, false, 2, 5, 3},
+		{"unsorted_first", []uint64{2, 1}, nil, false, 1, 2, 1},
+		{"signed", []uint64{1 << 63, 0, 1}, LessSigned, true, 0, 0, 0},
+		{"signed_unsorted", []uint64{0, 1 << 63}, LessSigned, false, 1, 0, 1 << 63},
+		{"descending", []uint64{3, 3, 1}, Reverse(LessUnsigned), true, 0, 0, 0},
+		{"descending_unsorted", []uint64{3, 1, 2}, Reverse(LessUnsigned), false, 2, 1, 2},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := CheckSorted(sortio.NewSliceUint64Reader(tc.input), tc.less)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Count != uint64(len(tc.input)) {
+				t.Fatalf("expected count %v, actual: %v", len(tc.input), result.Count)
+			}
+			if result.Sorted != tc.sorted {
+				t.Fatalf("expected sorted: %v, actual: %v", tc.sorted, result.Sorted)
+			}
+			if result.Position != tc.position || result.Previous != tc.previous || result.Value != tc.value {
+				t.Fatalf("expected violation at %v: %v, %v, actual: at %v: %v, %v",
+					tc.position, tc.previous, tc.value, result.Position, result.Previous, result.Value)
+			}
+		})
+	}
+}
+
+func TestCheckSorted_Error(t *testing.T) {
+	r := sortio.NewTextUint64ReaderCount(strings.NewReader("1 2 x"), 1)
+	result, err := CheckSorted(r, nil)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if result.Count != 2 {
+		t.Fatalf("expected count 2, actual: %v", result.Count)
+	}
+}
+
+func TestComputeDigest(t *testing.T) {
+	digest := func(values []uint64) Digest {
+		d, err := ComputeDigest(sortio.NewSliceUint64Reader(values))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return d
+	}
+
+	input := []uint64{5, 1, 5, 3, 0}
+	if digest(input) != digest([]uint64{0, 1, 3, 5, 5}) {
+		t.Fatalf("the digests of a permutation differ")
+	}
+	result, err := CheckSorted(sortio.NewSliceUint64Reader([]uint64{0, 1, 3, 5, 5}), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Digest != digest(input) {
+		t.Fatalf("the digest of the check differs from the digest of the input")
+	}
+
+	for _, other := range [][]uint64{{0, 1, 3, 5}, {0, 1, 3, 3, 5}, {0, 1, 3, 5, 5, 0}, {1, 1, 2, 5, 5}} {
+		if digest(other) == digest(input) {
+			t.Fatalf("expected the digests of %v and %v to differ", other, input)
+		}
+	}
+}
+
+func TestCheckSortedFunc_Records(t *testing.T) {
+	input := [][]byte{[]byte("a"), []byte("ab"), []byte("b"), []byte("aa")}
+	result, err := CheckSortedFunc[[]byte](sortio.NewSliceReader(input), LessBytes, HashBytes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Sorted || result.Position != 3 || string(result.Previous) != "b" || string(result.Value) != "aa" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	permutation := [][]byte{[]byte("aa"), []byte("b"), []byte("a"), []byte("ab")}
+	digest, err := ComputeDigestFunc[[]byte](sortio.NewSliceReader(permutation), HashBytes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if digest != result.Digest {
+		t.Fatalf("the digests of a permutation differ")
+	}
+}
@@ -0,0 +1,240 @@
+package extsort
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"log"
+	"os"
+)
+
+var ErrCheckpointMismatch = errors.New("the checkpoint was saved by an incompatible sort")
+
+const checkpointVersion = 1
+
+// Checkpoint is the state of a sort saved to Params.Checkpoint after the first stage and after every intermediate merge.
+type Checkpoint struct {
+	Version int
+	// Params are the parameters of the sort, which saved the checkpoint (except Less)
+	Params Params
+	// ValueSize is the size of the values in bytes
+	ValueSize int
+	// InputOffset is the number of values consumed from the input
+	InputOffset uint64
+	// Merges is the number of completed intermediate merges
+	Merges int
+	// Segments are the sorted runs left to merge. The order matters in stable mode.
+	Segments []CheckpointSegment
+}
+
+type CheckpointSegment struct {
+	File   string
+	Offset int64 // in bytes
+	Length uint64
+}
+
+func ReadCheckpoint(filename string) (*Checkpoint, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Checkpoint
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// writeCheckpoint replaces the checkpoint atomically, so that a valid checkpoint is left if the process dies
+func writeCheckpoint(filename string, c *Checkpoint) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFilename := filename + ".tmp"
+	f, err := os.Create(tmpFilename)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+
+	return os.Rename(tmpFilename, filename)
+}
+
+// ResumeMultiwayMergeSortParamsContext continues a sort of uint64 values from the checkpoint saved by
+// DoMultiwayMergeSortParamsContext with Params.Checkpoint set. The checkpoint keeps being updated.
+// The order of values must be the same as in the interrupted sort, the other parameters may differ,
+// except for Stable, Unique, Compression and Checksums (along with BufferSize, which defines the size
+// of the checksummed blocks).
+func ResumeMultiwayMergeSortParamsContext(
+	ctx context.Context,
+	checkpoint string,
+	w sortio.Uint64Writer,
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	params.Checkpoint = checkpoint
+	s := newSorter(ctx, params, uint64Ops(params), profiler)
+	defer s.close()
+	return s.resume(sortio.AsWriter(w))
+}
+
+// ResumeMultiwayMergeSortFuncContext is a generic counterpart of ResumeMultiwayMergeSortParamsContext.
+func ResumeMultiwayMergeSortFuncContext[T any](
+	ctx context.Context,
+	checkpoint string,
+	w sortio.Writer[T],
+	codec sortio.Codec[T],
+	less func(a, b T) bool,
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	params.Checkpoint = checkpoint
+	s := newSorter(ctx, params, funcOps(codec, less), profiler)
+	defer s.close()
+	return s.resume(w)
+}
+
+func (s *sorter[T]) resume(w sortio.Writer[T]) error {
+	err := s.validateParams()
+	if err != nil {
+		return err
+	}
+
+	c, err := ReadCheckpoint(s.params.Checkpoint)
+	if err != nil {
+		return err
+	}
+	if c.Version != checkpointVersion || c.ValueSize != s.ops.valueSize || c.Params.Stable != s.params.Stable {
+		return ErrCheckpointMismatch
+	}
+	if c.Params.Unique != s.params.Unique {
+		// the runs saved without Unique may contain the same values
+		return ErrCheckpointMismatch
+	}
+	if c.Params.Checksums != s.params.Checksums || c.Params.Compression != s.params.Compression ||
+		(c.Params.Checksums && c.Params.BufferSize != s.params.BufferSize) {
+		// the format of the temporary files differs
+		return ErrCheckpointMismatch
+	}
+
+	segments := make([]sortSegment, len(c.Segments))
+	for i, segment := range c.Segments {
+		segments[i] = sortSegment{segment.Offset, segment.Length, segment.File}
+		s.persisted[segment.File] = struct{}{}
+	}
+	s.inputOffset = c.InputOffset
+	s.merges = c.Merges
+
+	log.Printf("Resuming after %d merges...\n", c.Merges)
+	return s.mergeAll(segments, w)
+}
+
+// saveCheckpoint saves the segments left to merge if Params.Checkpoint is set.
+// The temporary files of the segments are persisted, and the persisted files, which are no longer needed, are removed.
+// The file names of the segments are updated in place.
+func (s *sorter[T]) saveCheckpoint(segments []sortSegment) error {
+	if s.params.Checkpoint == "" {
+		return nil
+	}
+
+	c := Checkpoint{
+		Version:     checkpointVersion,
+		Params:      s.params,
+		ValueSize:   s.ops.valueSize,
+		InputOffset: s.inputOffset,
+		Merges:      s.merges,
+	}
+	referenced := make(map[string]struct{})
+	renamed := make(map[string]string)
+	for i := range segments {
+		segment := &segments[i]
+		if _, ok := s.persisted[segment.filename]; !ok {
+			// the segments of the first stage share the file
+			persisted, ok := renamed[segment.filename]
+			if !ok {
+				var err error
+				persisted, err = s.persistTmpFile(segment.filename)
+				if err != nil {
+					return err
+				}
+				renamed[segment.filename] = persisted
+			}
+			segment.filename = persisted
+		}
+
+		referenced[segment.filename] = struct{}{}
+		c.Segments = append(c.Segments, CheckpointSegment{segment.filename, segment.offset, segment.count})
+	}
+
+	err := writeCheckpoint(s.params.Checkpoint, &c)
+	if err != nil {
+		return err
+	}
+
+	// the files merged into the new segments are no longer needed
+	for filename := range s.persisted {
+		if _, ok := referenced[filename]; !ok {
+			os.Remove(filename)
+			delete(s.persisted, filename)
+		}
+	}
+	return nil
+}
+
+func (s *sorter[T]) persistTmpFile(filename string) (string, error) {
+	// the temporary files are not synced by default (see Params.TempFileSync)
+	if err := syncFile(filename); err != nil {
+		return "", err
+	}
+	persisted, err := s.tmpDirs.Persist(filename)
+	if err != nil {
+		return "", err
+	}
+
+	for i, tmpFile := range s.tmpFiles {
+		if tmpFile == filename {
+			s.tmpFiles = append(s.tmpFiles[:i], s.tmpFiles[i+1:]...)
+			break
+		}
+	}
+	s.persisted[persisted] = struct{}{}
+	return persisted, nil
+}
+
+func syncFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// removeCheckpoint removes the checkpoint and the persisted files after the sort is finished
+func (s *sorter[T]) removeCheckpoint() {
+	if s.params.Checkpoint == "" {
+		return
+	}
+
+	for filename := range s.persisted {
+		os.Remove(filename)
+	}
+	s.persisted = make(map[string]struct{})
+	os.Remove(s.params.Checkpoint)
+}
@@ -0,0 +1,183 @@
+package extsort
+
+import (
+	"context"
+	"errors"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var errCrash = errors.New("crash")
+
+// sortWithFailingMerge runs the sort, which fails on the n-th merge
+func sortWithFailingMerge(input []uint64, params Params, n int) error {
+	ops := uint64Ops(params)
+	merge := ops.merge
+	merges := 0
+	ops.merge = func(readers []sortio.Reader[uint64], w sortio.Writer[uint64], params Params) error {
+		merges++
+		if merges == n {
+			return errCrash
+		}
+		return merge(readers, w, params)
+	}
+
+	s := newSorter(context.Background(), params, ops, util.NewNilSimpleProfiler())
+	defer s.close()
+	return s.doSort(sortio.NewSliceReader(input), sortio.NewSliceWriter[uint64]())
+}
+
+func checkpointTestParams(t *testing.T) Params {
+	return Params{
+		MemoryLimit:                  1000,
+		Arity:                        3,
+		ReserveMemoryForSegmentsInfo: 10000,
+		FirstStageMemoryLimit:        10,
+		BufferSize:                   2,
+		TempDirs:                     []string{t.TempDir()},
+		Checkpoint:                   filepath.Join(t.TempDir(), "checkpoint"),
+	}
+}
+
+func TestResumeMultiwayMergeSortParams(t *testing.T) {
+	for _, failedMerge := range []int{1, 2, 10, 49} {
+		params := checkpointTestParams(t)
+		input := generateRandomArray(1000)
+
+		err := sortWithFailingMerge(input, params, failedMerge)
+		if err != errCrash {
+			t.Fatalf("expected error: %v, actual: %v", errCrash, err)
+		}
+
+		checkpoint, err := ReadCheckpoint(params.Checkpoint)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if checkpoint.Merges != failedMerge-1 || checkpoint.InputOffset != 1000 {
+			t.Fatalf("unexpected checkpoint: %+v", checkpoint)
+		}
+		for _, segment := range checkpoint.Segments {
+			if !fileExists(segment.File) {
+				t.Fatalf("the file of the checkpoint is removed: %v", segment.File)
+			}
+		}
+
+		output := sortio.NewSliceUint64Writer()
+		err = ResumeMultiwayMergeSortParamsContext(context.Background(), params.Checkpoint, output,
+			params, util.NewNilSimpleProfiler())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		sort.Slice(input, func(i, j int) bool { return input[i] < input[j] })
+		if !reflect.DeepEqual(input, output.Data()) {
+			t.Fatalf("the actual output differs from the expected output")
+		}
+
+		// the checkpoint and the temporary files should be removed
+		if fileExists(params.Checkpoint) {
+			t.Fatalf("the checkpoint is not removed")
+		}
+		assertDirEmpty(t, params.TempDirs[0])
+	}
+}
+
+func TestResumeMultiwayMergeSortParams_Compression(t *testing.T) {
+	params := checkpointTestParams(t)
+	params.UseReplacementSelection = true
+	params.Compression = FlateCompression
+	params.Checksums = true
+	input := generateRandomArray(1000)
+
+	err := sortWithFailingMerge(input, params, 5)
+	if err != errCrash {
+		t.Fatalf("expected error: %v, actual: %v", errCrash, err)
+	}
+
+	output := sortio.NewSliceUint64Writer()
+	err = ResumeMultiwayMergeSortParamsContext(context.Background(), params.Checkpoint, output,
+		params, util.NewNilSimpleProfiler())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sort.Slice(input, func(i, j int) bool { return input[i] < input[j] })
+	if !reflect.DeepEqual(input, output.Data()) {
+		t.Fatalf("the actual output differs from the expected output")
+	}
+}
+
+func TestResumeMultiwayMergeSortParams_Stable(t *testing.T) {
+	params := checkpointTestParams(t)
+	params.Stable = true
+	params.Less = lessHighBits
+	input := generateValuesWithPositions(1000, 10)
+
+	err := sortWithFailingMerge(input, params, 40)
+	if err != errCrash {
+		t.Fatalf("expected error: %v, actual: %v", errCrash, err)
+	}
+
+	output := sortio.NewSliceUint64Writer()
+	err = ResumeMultiwayMergeSortParamsContext(context.Background(), params.Checkpoint, output,
+		params, util.NewNilSimpleProfiler())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	checkStablySorted(t, input, output.Data(), lessHighBits)
+	assertDirEmpty(t, params.TempDirs[0])
+}
+
+func TestResumeMultiwayMergeSortParams_Mismatch(t *testing.T) {
+	params := checkpointTestParams(t)
+	err := sortWithFailingMerge(generateRandomArray(1000), params, 1)
+	if err != errCrash {
+		t.Fatalf("expected error: %v, actual: %v", errCrash, err)
+	}
+
+	params.Stable = true
+	err = ResumeMultiwayMergeSortParamsContext(context.Background(), params.Checkpoint, sortio.NewSliceUint64Writer(),
+		params, util.NewNilSimpleProfiler())
+	if err != ErrCheckpointMismatch {
+		t.Fatalf("expected error: %v, actual: %v", ErrCheckpointMismatch, err)
+	}
+}
+
+func TestResumeMultiwayMergeSortParams_UniqueMismatch(t *testing.T) {
+	for _, unique := range []bool{false, true} {
+		params := checkpointTestParams(t)
+		params.Unique = unique
+		err := sortWithFailingMerge(generateValuesWithDuplicates(1000, 100), params, 1)
+		if err != errCrash {
+			t.Fatalf("expected error: %v, actual: %v", errCrash, err)
+		}
+
+		params.Unique = !unique
+		err = ResumeMultiwayMergeSortParamsContext(context.Background(), params.Checkpoint,
+			sortio.NewSliceUint64Writer(), params, util.NewNilSimpleProfiler())
+		if err != ErrCheckpointMismatch {
+			t.Fatalf("unique=%v: expected error: %v, actual: %v", unique, ErrCheckpointMismatch, err)
+		}
+	}
+}
+
+func TestDoMultiwayMergeSortParams_CheckpointRemoved(t *testing.T) {
+	params := checkpointTestParams(t)
+	input := generateRandomArray(1000)
+
+	err := DoMultiwayMergeSortParams(sortio.NewSliceUint64Reader(input), sortio.NewSliceUint64Writer(), params,
+		util.NewNilSimpleProfiler())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fileExists(params.Checkpoint) {
+		t.Fatalf("the checkpoint is not removed")
+	}
+	assertDirEmpty(t, params.TempDirs[0])
+}
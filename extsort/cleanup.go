@@ -0,0 +1,107 @@
+package extsort
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// cleanupRegistry keeps track of the temporary files of all the sorters in the process,
+// so that they can be removed when the process is interrupted by a signal or crashes because of a panic.
+type cleanupRegistry struct {
+	mutex sync.Mutex
+	files map[string]struct{}
+}
+
+var registry = &cleanupRegistry{files: make(map[string]struct{})}
+
+func (r *cleanupRegistry) Add(filename string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.files[filename] = struct{}{}
+}
+
+// Remove removes the file and forgets about it
+func (r *cleanupRegistry) Remove(filename string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	os.Remove(filename)
+	delete(r.files, filename)
+}
+
+// Forget forgets about the file without removing it
+func (r *cleanupRegistry) Forget(filename string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.files, filename)
+}
+
+func (r *cleanupRegistry) RemoveAll() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for filename := range r.files {
+		os.Remove(filename)
+	}
+	r.files = make(map[string]struct{})
+}
+
+// RemoveTemporaryFiles removes the temporary files of all the sorters in the process.
+// It should be called before the process exits without running the deferred functions (e.g. by os.Exit).
+// The sorters running at the moment fail after that.
+func RemoveTemporaryFiles() {
+	registry.RemoveAll()
+}
+
+// RegisterTemporaryFile makes RemoveTemporaryFiles, CleanupOnSignals and CleanupOnPanic remove the file
+// along with the temporary files of the sorters, e.g. an output, which is not complete yet.
+func RegisterTemporaryFile(filename string) {
+	registry.Add(filename)
+}
+
+// ForgetTemporaryFile undoes RegisterTemporaryFile without removing the file
+func ForgetTemporaryFile(filename string) {
+	registry.Forget(filename)
+}
+
+// CleanupOnSignals removes the temporary files and exits with the conventional status (128 + signal number)
+// when the process receives one of the signals (SIGINT or SIGTERM by default).
+// The returned function stops handling the signals.
+func CleanupOnSignals(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, sigs...)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			RemoveTemporaryFiles()
+			status := 1
+			if signum, ok := sig.(syscall.Signal); ok {
+				status = 128 + int(signum)
+			}
+			os.Exit(status)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// CleanupOnPanic removes the temporary files if the calling goroutine panics. It must be deferred.
+// The panic is propagated after the cleanup.
+// A panic in any goroutine crashes the whole process without running the deferred functions of the other goroutines,
+// so the goroutines started by the sorting functions use it as well.
+func CleanupOnPanic() {
+	if r := recover(); r != nil {
+		RemoveTemporaryFiles()
+		panic(r)
+	}
+}
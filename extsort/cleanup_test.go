@@ -0,0 +1,129 @@
+package extsort
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createFile(t *testing.T, filename string) {
+	if err := os.WriteFile(filename, []byte("data"), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+func TestSweepStaleTmpFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	// the files of a dead process: the lock file is not locked
+	staleLock := filepath.Join(dir, "extsort_123.lock")
+	staleTmp := filepath.Join(dir, "extsort_123_tmp_456")
+	createFile(t, staleLock)
+	createFile(t, staleTmp)
+
+	// the files of a live sorter
+	tmpDirs := newTempDirs([]string{dir}, RoundRobin)
+	defer tmpDirs.Close()
+	liveTmp, err := tmpDirs.CreateTemp()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	liveTmp.Close()
+	defer tmpDirs.Remove(liveTmp.Name())
+
+	// an unrelated file
+	unrelated := filepath.Join(dir, "extsort_data")
+	createFile(t, unrelated)
+
+	sweepStaleTmpFiles(dir)
+
+	if _, err := tryLockFile(liveTmp); err == ErrNotSupported {
+		t.Skip("file locks are not supported on this platform")
+	}
+	if fileExists(staleLock) || fileExists(staleTmp) {
+		t.Fatalf("the stale files are not removed")
+	}
+	if !fileExists(liveTmp.Name()) || !fileExists(tmpDirs.locks[dir].f.Name()) {
+		t.Fatalf("the files of a live sorter are removed")
+	}
+	if !fileExists(unrelated) {
+		t.Fatalf("an unrelated file is removed")
+	}
+}
+
+func TestTempDirs_StaleFilesSweptOnFirstUse(t *testing.T) {
+	dir := t.TempDir()
+	staleLock := filepath.Join(dir, "extsort_123.lock")
+	staleTmp := filepath.Join(dir, "extsort_123_tmp_456")
+	createFile(t, staleLock)
+	createFile(t, staleTmp)
+
+	tmpDirs := newTempDirs([]string{dir}, RoundRobin)
+	defer tmpDirs.Close()
+	f, err := tmpDirs.CreateTemp()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.Close()
+	defer tmpDirs.Remove(f.Name())
+
+	if _, err := tryLockFile(f); err == ErrNotSupported {
+		t.Skip("file locks are not supported on this platform")
+	}
+	if fileExists(staleTmp) {
+		t.Fatalf("the stale file is not removed")
+	}
+}
+
+func TestRemoveTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	tmpDirs := newTempDirs([]string{dir}, RoundRobin)
+	defer tmpDirs.Close()
+
+	f, err := tmpDirs.CreateTemp()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.Close()
+
+	RemoveTemporaryFiles()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("the temporary files are not removed: %v", entries)
+	}
+}
+
+func TestCleanupOnPanic(t *testing.T) {
+	dir := t.TempDir()
+	tmpDirs := newTempDirs([]string{dir}, RoundRobin)
+	defer tmpDirs.Close()
+
+	f, err := tmpDirs.CreateTemp()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.Close()
+
+	func() {
+		defer func() {
+			if r := recover(); r != "test panic" {
+				t.Fatalf("the panic is not propagated: %v", r)
+			}
+		}()
+		defer CleanupOnPanic()
+		panic("test panic")
+	}()
+
+	if fileExists(f.Name()) {
+		t.Fatalf("the temporary file is not removed")
+	}
+}
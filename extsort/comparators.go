@@ -0,0 +1,18 @@
+package extsort
+
+// The functions below can be used as Params.Less.
+
+// LessUnsigned defines the default (ascending) order of values.
+func LessUnsigned(a, b uint64) bool {
+	return a < b
+}
+
+// LessSigned interprets values as two's complement signed integers.
+func LessSigned(a, b uint64) bool {
+	return int64(a) < int64(b)
+}
+
+// Reverse returns the order opposite to the one defined by less.
+func Reverse[T any](less func(a, b T) bool) func(a, b T) bool {
+	return func(a, b T) bool { return less(b, a) }
+}
@@ -0,0 +1,41 @@
+package extsort
+
+import (
+	sortio "github.com/xosmig/extsort/io"
+	"io"
+)
+
+// Compression is the format of the temporary files (see Params.Compression).
+// The ratio is reported by the profiler (see util.SimpleProfiler.GetCompressionRatio).
+type Compression int
+
+const (
+	// NoCompression stores the values as is
+	NoCompression Compression = iota
+	// DeltaCompression stores the differences between adjacent values of a run as varints,
+	// which takes 1-3 bytes per value for dense inputs (see sortio.CompressedUint64Writer)
+	DeltaCompression
+	// FlateCompression additionally compresses the blocks of DeltaCompression by flate.
+	// It pays off for inputs with many repeated patterns and costs CPU time.
+	FlateCompression
+)
+
+// seekableWriter is implemented by the writers of the temporary files, whose values take different numbers of bytes,
+// so that the offset of a segment cannot be computed from the index of its first value
+type seekableWriter interface {
+	SeekOffset(index uint64) (int64, bool)
+}
+
+func newCompressedUint64SegmentReader(
+	r io.Reader,
+	count int,
+	compression Compression,
+	length uint64) sortio.Reader[uint64] {
+
+	reader := sortio.NewCompressedUint64ReaderCount(r, count, compression == FlateCompression)
+	return sortio.NewBoundedUint64Reader(reader, length)
+}
+
+func newCompressedUint64TmpWriter(w sortio.WriteSyncer, count int, compression Compression) sortio.Writer[uint64] {
+	return sortio.NewCompressedUint64WriterCount(w, count, compression == FlateCompression)
+}
@@ -0,0 +1,118 @@
+package extsort
+
+import (
+	"context"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+)
+
+// contextCheckInterval is the number of values read between the checks of the context.
+// The check is cheap, but not free, while the values are read in tight loops.
+const contextCheckInterval = 4096
+
+// The sorting functions are cancelled by wrapping their readers: all the loops of the algorithms read values
+// and stop on the first read error, so the context is checked periodically in every read loop and merge loop.
+
+// contextReader returns ctx.Err() instead of the next value after the context is cancelled
+type contextReader[T any] struct {
+	impl      sortio.Reader[T]
+	ctx       context.Context
+	countdown int
+}
+
+func (r *contextReader[T]) SetProfiler(p *util.SimpleProfiler) {
+	r.impl.SetProfiler(p)
+}
+
+func (r *contextReader[T]) Read() (T, error) {
+	r.countdown--
+	if r.countdown <= 0 {
+		r.countdown = contextCheckInterval
+		if err := r.ctx.Err(); err != nil {
+			var zero T
+			return zero, err
+		}
+	}
+	return r.impl.Read()
+}
+
+// contextUint64Reader is a specialized counterpart of contextReader
+type contextUint64Reader struct {
+	impl      sortio.Uint64Reader
+	ctx       context.Context
+	countdown int
+}
+
+func (r *contextUint64Reader) SetProfiler(p *util.SimpleProfiler) {
+	r.impl.SetProfiler(p)
+}
+
+func (r *contextUint64Reader) ReadUint64() (uint64, error) {
+	r.countdown--
+	if r.countdown <= 0 {
+		r.countdown = contextCheckInterval
+		if err := r.ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	return r.impl.ReadUint64()
+}
+
+func (r *contextUint64Reader) Read() (uint64, error) {
+	return r.ReadUint64()
+}
+
+// withContextUint64 wraps the reader unless the context can never be cancelled
+func withContextUint64(ctx context.Context, r sortio.Uint64Reader) sortio.Uint64Reader {
+	if ctx.Done() == nil {
+		return r
+	}
+	return &contextUint64Reader{impl: r, ctx: ctx}
+}
+
+// withContext wraps the reader unless the context can never be cancelled.
+// The specialized uint64 readers are wrapped by contextUint64Reader to keep them fast.
+func withContext[T any](ctx context.Context, r sortio.Reader[T]) sortio.Reader[T] {
+	if ctx.Done() == nil {
+		return r
+	}
+	// the check of Reader[uint64] makes sure that T is uint64, since a reader of other values may also have ReadUint64
+	if _, ok := any(r).(sortio.Reader[uint64]); ok {
+		if uint64Reader, ok := any(r).(sortio.Uint64Reader); ok {
+			return any(&contextUint64Reader{impl: uint64Reader, ctx: ctx}).(sortio.Reader[T])
+		}
+	}
+	return &contextReader[T]{impl: r, ctx: ctx}
+}
+
+// DoFirstStageParamsContext is like DoFirstStageParams, but it stops and returns ctx.Err()
+// soon after the context is cancelled.
+func DoFirstStageParamsContext(
+	ctx context.Context,
+	r sortio.Uint64Reader,
+	w sortio.Uint64Writer,
+	params Params) ([]Segment, error) {
+
+	return DoFirstStageParams(withContextUint64(ctx, r), w, params)
+}
+
+// DoFirstStageParamsFuncContext is a generic counterpart of DoFirstStageParamsContext.
+func DoFirstStageParamsFuncContext[T any](
+	ctx context.Context,
+	r sortio.Reader[T],
+	w sortio.Writer[T],
+	less func(a, b T) bool,
+	params Params) ([]Segment, error) {
+
+	return DoFirstStageParamsFunc(withContext(ctx, r), w, less, params)
+}
+
+// DoMultiwayMergeContext is like DoMultiwayMerge, but it stops and returns ctx.Err()
+// soon after the context is cancelled.
+func DoMultiwayMergeContext(ctx context.Context, readers []sortio.Uint64Reader, writer sortio.Uint64Writer) error {
+	contextReaders := make([]sortio.Uint64Reader, len(readers))
+	for i, r := range readers {
+		contextReaders[i] = withContextUint64(ctx, r)
+	}
+	return DoMultiwayMerge(contextReaders, writer)
+}
@@ -0,0 +1,162 @@
+package extsort
+
+import (
+	"context"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// cancellingUint64Reader cancels the context after the given number of values is read
+type cancellingUint64Reader struct {
+	sortio.Uint64Reader
+	cancel    context.CancelFunc
+	countdown int
+}
+
+func (r *cancellingUint64Reader) ReadUint64() (uint64, error) {
+	r.countdown--
+	if r.countdown == 0 {
+		r.cancel()
+	}
+	return r.Uint64Reader.ReadUint64()
+}
+
+func (r *cancellingUint64Reader) Read() (uint64, error) {
+	return r.ReadUint64()
+}
+
+func contextTestParams(dir string) Params {
+	return Params{
+		MemoryLimit:                  10000,
+		Arity:                        3,
+		ReserveMemoryForSegmentsInfo: 100000,
+		FirstStageMemoryLimit:        100,
+		BufferSize:                   10,
+		TempDirs:                     []string{dir},
+	}
+}
+
+func assertDirEmpty(t *testing.T, dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("the temporary files are not removed from %v", dir)
+	}
+}
+
+func TestDoMultiwayMergeSortParamsContext_Cancelled(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	input := sortio.NewSliceUint64Reader(generateRandomArray(100000))
+	err := DoMultiwayMergeSortParamsContext(
+		ctx, input, sortio.NewNullUint64Writer(), contextTestParams(dir), util.NewNilSimpleProfiler())
+	if err != context.Canceled {
+		t.Fatalf("expected error: %v, actual: %v", context.Canceled, err)
+	}
+	assertDirEmpty(t, dir)
+}
+
+func TestDoMultiwayMergeSortParamsContext_CancelledWhileSorting(t *testing.T) {
+	for _, count := range []int{100, 50000, 99999} {
+		dir := t.TempDir()
+		ctx, cancel := context.WithCancel(context.Background())
+
+		input := &cancellingUint64Reader{
+			Uint64Reader: sortio.NewSliceUint64Reader(generateRandomArray(100000)),
+			cancel:       cancel,
+			countdown:    count,
+		}
+		err := DoMultiwayMergeSortParamsContext(
+			ctx, input, sortio.NewNullUint64Writer(), contextTestParams(dir), util.NewNilSimpleProfiler())
+		if err != context.Canceled {
+			t.Fatalf("expected error: %v, actual: %v", context.Canceled, err)
+		}
+		assertDirEmpty(t, dir)
+		cancel()
+	}
+}
+
+func TestDoMultiwayMergeSortFuncContext_Cancelled(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	input := sortio.NewSliceReader(generateRandomArray(100000))
+	err := DoMultiwayMergeSortFuncContext[uint64](
+		ctx, input, sortio.NewSliceWriter[uint64](), sortio.Uint64Codec{}, LessUnsigned,
+		contextTestParams(dir), util.NewNilSimpleProfiler())
+	if err != context.Canceled {
+		t.Fatalf("expected error: %v, actual: %v", context.Canceled, err)
+	}
+	assertDirEmpty(t, dir)
+}
+
+func TestDoMultiwayMergeSortParamsContext_NotCancelled(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	output := sortio.NewSliceUint64Writer()
+	err := DoMultiwayMergeSortParamsContext(
+		ctx, sortio.NewSliceUint64Reader(generateRandomArray(100000)), output,
+		contextTestParams(dir), util.NewNilSimpleProfiler())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(output.Data()) != 100000 {
+		t.Fatalf("expected %v values, actual: %v", 100000, len(output.Data()))
+	}
+	assertDirEmpty(t, dir)
+}
+
+func TestDoMultiwayMergeContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	readers := []sortio.Uint64Reader{
+		sortio.NewSliceUint64Reader(make([]uint64, 10000)),
+		sortio.NewSliceUint64Reader(make([]uint64, 10000)),
+	}
+	err := DoMultiwayMergeContext(ctx, readers, sortio.NewNullUint64Writer())
+	if err != context.Canceled {
+		t.Fatalf("expected error: %v, actual: %v", context.Canceled, err)
+	}
+}
+
+// int64UintReader reads int64 values, but it also has ReadUint64 like the readers of uint64 values
+type int64UintReader struct {
+	*sortio.SliceReader[int64]
+}
+
+func (r int64UintReader) ReadUint64() (uint64, error) {
+	x, err := r.Read()
+	return uint64(x), err
+}
+
+func TestDoMultiwayMergeInputsFuncContext_ReaderWithReadUint64(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	readers := []sortio.Reader[int64]{
+		int64UintReader{sortio.NewSliceReader([]int64{-3, 1, 5})},
+		int64UintReader{sortio.NewSliceReader([]int64{-2, 4})},
+	}
+	output := sortio.NewSliceWriter[int64]()
+	err := DoMultiwayMergeInputsFuncContext[int64](ctx, readers, output, sortio.Int64Codec{},
+		func(a, b int64) bool { return a < b }, contextTestParams(t.TempDir()), util.NewNilSimpleProfiler())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []int64{-3, -2, 1, 4, 5}
+	if !reflect.DeepEqual(expected, output.Data()) {
+		t.Fatalf("expected: %v, actual: %v", expected, output.Data())
+	}
+}
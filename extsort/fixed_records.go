@@ -0,0 +1,57 @@
+package extsort
+
+import (
+	"bytes"
+	"context"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+)
+
+// FixedRecordLess returns a function comparing fixed-width records by their keys.
+func FixedRecordLess(format sortio.FixedRecordFormat) func(a, b []byte) bool {
+	switch format.KeyType {
+	case sortio.KeyUint64:
+		return func(a, b []byte) bool { return format.KeyUint64(a) < format.KeyUint64(b) }
+	default:
+		return func(a, b []byte) bool { return bytes.Compare(format.Key(a), format.Key(b)) < 0 }
+	}
+}
+
+// FixedRecordMemory returns the approximate amount of memory used to keep a fixed-width record of the size in memory:
+// the record is allocated separately by the codec (see sortio.FixedBytesCodec), which is rounded up to a size class
+// of the allocator, and it is referenced by a slice header (see recordOverhead).
+func FixedRecordMemory(size int) int {
+	// the size classes of the Go allocator are less than 25% apart, and so are the pages of the large objects
+	allocated := (size + size/4 + 7) &^ 7
+	return allocated + recordOverhead
+}
+
+// DoMultiwayMergeSortFixedRecords sorts fixed-width records by their keys.
+// The payloads are carried along with the keys through all the stages of the algorithm.
+// Params are expressed in records rather than in 8-byte values, a record takes FixedRecordMemory bytes of memory.
+func DoMultiwayMergeSortFixedRecords(
+	r sortio.Reader[[]byte],
+	w sortio.Writer[[]byte],
+	format sortio.FixedRecordFormat,
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	return DoMultiwayMergeSortFixedRecordsContext(context.Background(), r, w, format, params, profiler)
+}
+
+// DoMultiwayMergeSortFixedRecordsContext is like DoMultiwayMergeSortFixedRecords, but it can be cancelled
+// (see DoMultiwayMergeSortParamsContext).
+func DoMultiwayMergeSortFixedRecordsContext(
+	ctx context.Context,
+	r sortio.Reader[[]byte],
+	w sortio.Writer[[]byte],
+	format sortio.FixedRecordFormat,
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	if err := format.Validate(); err != nil {
+		return err
+	}
+
+	return DoMultiwayMergeSortFuncContext[[]byte](ctx, r, w, format.Codec(), FixedRecordLess(format), params, profiler)
+}
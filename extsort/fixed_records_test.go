@@ -0,0 +1,133 @@
+package extsort
+
+import (
+	"encoding/binary"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"math/rand"
+	"testing"
+	"unsafe"
+)
+
+func TestDoMultiwayMergeSortFixedRecords(t *testing.T) {
+	// 4 bytes of payload, 8 bytes of key, 4 more bytes of payload
+	format := sortio.FixedRecordFormat{Size: 16, KeyOffset: 4, KeyLength: 8, KeyType: sortio.KeyUint64}
+	params := Params{
+		MemoryLimit:                  1000,
+		Arity:                        3,
+		ReserveMemoryForSegmentsInfo: 100,
+		FirstStageMemoryLimit:        5,
+		BufferSize:                   2,
+	}
+
+	// the payload is derived from the key, so that it is possible to check that it travels along with the key
+	const N = 100
+	inputData := make([][]byte, N)
+	for i := range inputData {
+		key := rand.Uint64() % 1000
+		record := make([]byte, format.Size)
+		binary.LittleEndian.PutUint32(record, uint32(key*3))
+		binary.LittleEndian.PutUint64(record[4:], key)
+		binary.LittleEndian.PutUint32(record[12:], uint32(key*7))
+		inputData[i] = record
+	}
+
+	for _, useReplacementSelection := range []bool{false, true} {
+		params.UseReplacementSelection = useReplacementSelection
+
+		output := sortio.NewSliceWriter[[]byte]()
+		err := DoMultiwayMergeSortFixedRecords(sortio.NewSliceReader(inputData), output, format, params,
+			util.NewNilSimpleProfiler())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(output.Data()) != N {
+			t.Fatalf("expected output length: %v, actual: %v", N, len(output.Data()))
+		}
+
+		var prevKey uint64 = 0
+		for i, record := range output.Data() {
+			key := format.KeyUint64(record)
+			if key < prevKey {
+				t.Fatalf("the output is not sorted at position %v", i)
+			}
+			if binary.LittleEndian.Uint32(record) != uint32(key*3) ||
+				binary.LittleEndian.Uint32(record[12:]) != uint32(key*7) {
+				t.Fatalf("the payload does not match the key at position %v", i)
+			}
+			prevKey = key
+		}
+	}
+}
+
+func TestFixedRecordLess_Bytes(t *testing.T) {
+	format := sortio.FixedRecordFormat{Size: 4, KeyOffset: 1, KeyLength: 2, KeyType: sortio.KeyBytes}
+	less := FixedRecordLess(format)
+
+	if !less([]byte("zabz"), []byte("aaca")) {
+		t.Errorf("expected key \"ab\" to be less than \"ac\"")
+	}
+	if less([]byte("abcz"), []byte("zbca")) {
+		t.Errorf("expected equal keys to be not less than each other")
+	}
+}
+
+func TestFixedRecordLess_BigEndianUint64(t *testing.T) {
+	format := sortio.FixedRecordFormat{Size: 8, KeyLength: 8, KeyType: sortio.KeyUint64, ByteOrder: binary.BigEndian}
+	less := FixedRecordLess(format)
+
+	// 256 and 1 in big-endian byte order
+	a := []byte{0, 0, 0, 0, 0, 0, 1, 0}
+	b := []byte{0, 0, 0, 0, 0, 0, 0, 1}
+	if !less(b, a) || less(a, b) {
+		t.Errorf("expected key 1 to be less than 256")
+	}
+}
+
+func TestFixedRecordFormat_Validate(t *testing.T) {
+	invalidFormats := []sortio.FixedRecordFormat{
+		{Size: 0, KeyOffset: 0, KeyLength: 1},
+		{Size: 8, KeyOffset: 4, KeyLength: 8},
+		{Size: 16, KeyOffset: 0, KeyLength: 4, KeyType: sortio.KeyUint64},
+	}
+
+	for _, format := range invalidFormats {
+		if format.Validate() == nil {
+			t.Errorf("expected format %+v to be invalid", format)
+		}
+	}
+}
+
+// decodedRecord keeps the decoded records on the heap
+var decodedRecord []byte
+
+func TestFixedRecordMemory(t *testing.T) {
+	// the sizes of the objects allocated by the Go allocator for records of the sizes (the size classes
+	// and the pages of the large objects), which are the furthest from the size
+	testcases := []struct {
+		size      int
+		allocated int
+	}{
+		{1, 8},
+		{17, 24},
+		{100, 112},
+		{2689, 3072},
+		{6913, 8192},
+		{40000, 40960},
+	}
+
+	for _, tc := range testcases {
+		codec := sortio.FixedBytesCodec{Length: tc.size}
+		buf := make([]byte, tc.size)
+		// the decoded record is the only allocation
+		if allocs := testing.AllocsPerRun(10, func() { decodedRecord = codec.Decode(buf) }); allocs != 1 {
+			t.Fatalf("size %v: expected 1 allocation per record, actual: %v", tc.size, allocs)
+		}
+
+		expected := tc.allocated + int(unsafe.Sizeof(buf))
+		if FixedRecordMemory(tc.size) < expected {
+			t.Fatalf("size %v: expected at least %v bytes, actual: %v", tc.size, expected, FixedRecordMemory(tc.size))
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package extsort
+
+import (
+	"fmt"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"io"
+)
+
+// forecaster implements the forecasting technique from Knuth's TAOCP (vol. 3, 5.4.6).
+// Each segment reader has a single block of values, and there is one spare block.
+// Since the segments are sorted, the reader whose block ends with the smallest value
+// is the one which exhausts its block first. The next block of this reader is read
+// into the spare block on a background goroutine while the merge consumes the other blocks.
+// Thus, k+1 blocks are enough to overlap reading with merging instead of 2k blocks for double buffering.
+//
+// Only the goroutine performing the merge calls the methods of forecaster and its readers.
+type forecaster[T any] struct {
+	codec    sortio.Codec[T]
+	less     func(a, b T) bool
+	readers  []*forecastReader[T]
+	byteBuf  []byte // used by the synchronous reads
+	profiler *util.SimpleProfiler
+
+	spare      []T
+	spareBytes []byte
+	prefetched int // the index of the reader, for which the spare block is being filled, or -1
+	done       chan prefetchResult
+}
+
+type prefetchResult struct {
+	count int
+	err   error
+}
+
+type forecastReader[T any] struct {
+	f         *forecaster[T]
+	idx       int
+	stream    io.Reader
+	block     []T
+	values    []T    // the unread part of the block
+	remaining uint64 // the number of values in the segment which are not read into the block yet
+	loaded    bool   // whether the first block is read
+}
+
+func newForecaster[T any](
+	codec sortio.Codec[T],
+	less func(a, b T) bool,
+	blockSize int,
+	byteBuf []byte,
+	profiler *util.SimpleProfiler) *forecaster[T] {
+
+	return &forecaster[T]{
+		codec:      codec,
+		less:       less,
+		byteBuf:    byteBuf,
+		profiler:   profiler,
+		spare:      make([]T, blockSize),
+		spareBytes: make([]byte, blockSize*codec.Size()),
+		prefetched: -1,
+		done:       make(chan prefetchResult, 1),
+	}
+}
+
+// AddReader adds a reader of the segment of the given length from the stream.
+func (f *forecaster[T]) AddReader(stream io.Reader, length uint64) sortio.Reader[T] {
+	r := &forecastReader[T]{
+		f:         f,
+		idx:       len(f.readers),
+		stream:    stream,
+		block:     make([]T, len(f.spare)),
+		remaining: length,
+	}
+	f.readers = append(f.readers, r)
+	return r
+}
+
+// Close waits for the background read to finish, so that the files can be safely closed.
+func (f *forecaster[T]) Close() {
+	if f.prefetched != -1 {
+		<-f.done
+		f.prefetched = -1
+	}
+}
+
+// readBlock reads the next block of the reader r into dst
+func (f *forecaster[T]) readBlock(r *forecastReader[T], dst []T, byteBuf []byte) (int, error) {
+	count := len(dst)
+	if uint64(count) > r.remaining {
+		count = int(r.remaining)
+	}
+
+	size := f.codec.Size()
+	_, err := io.ReadFull(r.stream, byteBuf[:count*size])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, fmt.Errorf("unexpected end of a segment: %v values are missing", r.remaining)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for idx := 0; idx < count; idx++ {
+		dst[idx] = f.codec.Decode(byteBuf[idx*size:])
+	}
+	return count, nil
+}
+
+// forecast starts reading the next block of the reader, which will exhaust its block first
+func (f *forecaster[T]) forecast() {
+	next := -1
+	for idx, r := range f.readers {
+		if !r.loaded && r.remaining > 0 {
+			// the forecast is not possible until the first blocks of all the readers are read
+			return
+		}
+		if r.remaining == 0 || len(r.values) == 0 {
+			continue
+		}
+		if next == -1 || f.less(r.values[len(r.values)-1], f.readers[next].values[len(f.readers[next].values)-1]) {
+			next = idx
+		}
+	}
+
+	if next == -1 {
+		return
+	}
+
+	f.prefetched = next
+	r := f.readers[next]
+	go func() {
+		defer CleanupOnPanic()
+		count, err := f.readBlock(r, f.spare, f.spareBytes)
+		f.done <- prefetchResult{count, err}
+	}()
+}
+
+func (r *forecastReader[T]) SetProfiler(p *util.SimpleProfiler) {}
+
+// refill either puts 1 or more new values to r.values or returns an error
+func (r *forecastReader[T]) refill() error {
+	if r.remaining == 0 {
+		return io.EOF
+	}
+
+	f := r.f
+	var count int
+	var err error
+
+	f.profiler.StartMeasuring()
+	if f.prefetched == r.idx {
+		// the forecast was correct
+		result := <-f.done
+		f.prefetched = -1
+		count, err = result.count, result.err
+		r.block, f.spare = f.spare, r.block
+	} else {
+		// either the first block or an incorrect forecast (possible when the last values of the blocks are equal)
+		count, err = f.readBlock(r, r.block, f.byteBuf)
+	}
+	f.profiler.FinishMeasuring()
+
+	if err != nil {
+		return err
+	}
+
+	r.remaining -= uint64(count)
+	r.values = r.block[:count]
+	r.loaded = true
+
+	if f.prefetched == -1 {
+		f.forecast()
+	}
+	return nil
+}
+
+func (r *forecastReader[T]) Read() (T, error) {
+	if len(r.values) == 0 {
+		if err := r.refill(); err != nil {
+			var zero T
+			return zero, err
+		}
+	}
+
+	value := r.values[0]
+	r.values = r.values[1:]
+	return value, nil
+}
@@ -0,0 +1,72 @@
+package extsort
+
+import (
+	"bytes"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func encodeValues(values []uint64) *bytes.Reader {
+	codec := sortio.Uint64Codec{}
+	buf := make([]byte, len(values)*codec.Size())
+	for i, value := range values {
+		codec.Encode(buf[i*codec.Size():], value)
+	}
+	return bytes.NewReader(buf)
+}
+
+func TestForecaster(t *testing.T) {
+	const BlockSize = 3
+
+	var inputs [][]uint64
+	// many equal values, so that the forecasts are often incorrect
+	for i := 0; i < 5; i++ {
+		input := make([]uint64, rand.Intn(50))
+		for j := range input {
+			input[j] = uint64(rand.Intn(10))
+		}
+		sort.Slice(input, func(i, j int) bool { return input[i] < input[j] })
+		inputs = append(inputs, input)
+	}
+	inputs = append(inputs, []uint64{})
+
+	forecaster := newForecaster[uint64](sortio.Uint64Codec{}, LessUnsigned, BlockSize,
+		make([]byte, BlockSize*sortio.SizeOfValue), util.NewNilSimpleProfiler())
+	var readers []sortio.Reader[uint64]
+	var expectedOutput []uint64
+	for _, input := range inputs {
+		readers = append(readers, forecaster.AddReader(encodeValues(input), uint64(len(input))))
+		expectedOutput = append(expectedOutput, input...)
+	}
+	sort.Slice(expectedOutput, func(i, j int) bool { return expectedOutput[i] < expectedOutput[j] })
+
+	output := sortio.NewSliceWriter[uint64]()
+	err := DoMultiwayMergeFunc(readers, output, LessUnsigned)
+	forecaster.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(expectedOutput) != len(output.Data()) || !reflect.DeepEqual(expectedOutput, output.Data()) {
+		t.Fatalf("expected output: %v, actual: %v", expectedOutput, output.Data())
+	}
+}
+
+func TestForecaster_TruncatedSegment(t *testing.T) {
+	forecaster := newForecaster[uint64](sortio.Uint64Codec{}, LessUnsigned, 2,
+		make([]byte, 2*sortio.SizeOfValue), util.NewNilSimpleProfiler())
+	defer forecaster.Close()
+
+	r := forecaster.AddReader(encodeValues([]uint64{1, 2, 3}), 5)
+	var err error
+	for i := 0; i < 5 && err == nil; i++ {
+		_, err = r.Read()
+	}
+	if err == nil {
+		t.Fatalf("expected an error for a truncated segment")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd)
+
+package extsort
+
+import "os"
+
+// freeSpace is not supported on this platform, so MostFreeSpace falls back to RoundRobin
+func freeSpace(dir string) (uint64, error) {
+	return 0, ErrNotSupported
+}
+
+// tryLockFile is not supported on this platform, so the stale temporary files are not swept
+func tryLockFile(f *os.File) (bool, error) {
+	return false, ErrNotSupported
+}
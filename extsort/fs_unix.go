@@ -0,0 +1,30 @@
+//go:build linux || darwin || freebsd
+
+package extsort
+
+import (
+	"os"
+	"syscall"
+)
+
+// freeSpace returns the number of bytes available to an unprivileged user in the file system of the directory
+func freeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+// tryLockFile tries to take an exclusive advisory lock on the file without blocking.
+// The lock is released when the file is closed or the process dies.
+func tryLockFile(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
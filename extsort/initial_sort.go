@@ -11,14 +11,30 @@ func DoInitialSort(
 	w sortio.Uint64Writer,
 	bufferMemoryLimit, segmentsMemoryLimit int) ([]Segment, error) {
 
-	var valuesBuf = make([]uint64, bufferMemoryLimit)
+	return DoInitialSortAlgorithm(r, w, ComparisonSort, bufferMemoryLimit, segmentsMemoryLimit)
+}
+
+// DoInitialSortAlgorithm is like DoInitialSort, but the chunks are sorted by the given algorithm.
+// The scratch buffer of the algorithm (if any) is taken from bufferMemoryLimit.
+func DoInitialSortAlgorithm(
+	r sortio.Uint64Reader,
+	w sortio.Uint64Writer,
+	algorithm InMemorySort,
+	bufferMemoryLimit, segmentsMemoryLimit int) ([]Segment, error) {
+
+	chunkSize := algorithm.chunkSize(bufferMemoryLimit)
+	if chunkSize < 1 {
+		return nil, ErrNotEnoughMemory
+	}
+	var valuesBuf = make([]uint64, chunkSize)
+	sortChunk := algorithm.newChunkSorter(chunkSize)
 
 	var segments []Segment
 	var segmentBegin uint64 = 0
 	var err error
 	for err != io.EOF {
 		var count uint64
-		count, err = doReadAndSort(r, w, valuesBuf)
+		count, err = doReadAndSort(r, w, sortChunk, valuesBuf)
 		if err != nil && err != io.EOF {
 			return nil, err
 		}
@@ -37,6 +53,7 @@ func DoInitialSort(
 func doReadAndSort(
 	r sortio.Uint64Reader,
 	w sortio.Uint64Writer,
+	sortChunk func(chunk []uint64),
 	valuesBuf []uint64) (uint64, error) {
 
 	//log.Println("Reading values...")
@@ -60,7 +77,7 @@ func doReadAndSort(
 	}
 
 	//log.Println("Sorting...")
-	sort.Slice(valuesBuf[:valuesRead], func(i, j int) bool { return valuesBuf[i] < valuesBuf[j] })
+	sortChunk(valuesBuf[:valuesRead])
 
 	//log.Println("Writing...")
 	for _, value := range valuesBuf[:valuesRead] {
@@ -77,3 +94,98 @@ func doReadAndSort(
 	//log.Println("Done.")
 	return uint64(valuesRead), nil
 }
+
+// DoInitialSortFunc is a generic counterpart of DoInitialSort. Values are ordered by the less function.
+func DoInitialSortFunc[T any](
+	r sortio.Reader[T],
+	w sortio.Writer[T],
+	less func(a, b T) bool,
+	bufferMemoryLimit, segmentsMemoryLimit int) ([]Segment, error) {
+
+	return doInitialSortFunc(r, w, less, false, bufferMemoryLimit, segmentsMemoryLimit)
+}
+
+// DoInitialSortStableFunc is like DoInitialSortFunc, but it preserves the input order of equal values.
+func DoInitialSortStableFunc[T any](
+	r sortio.Reader[T],
+	w sortio.Writer[T],
+	less func(a, b T) bool,
+	bufferMemoryLimit, segmentsMemoryLimit int) ([]Segment, error) {
+
+	return doInitialSortFunc(r, w, less, true, bufferMemoryLimit, segmentsMemoryLimit)
+}
+
+func doInitialSortFunc[T any](
+	r sortio.Reader[T],
+	w sortio.Writer[T],
+	less func(a, b T) bool,
+	stable bool,
+	bufferMemoryLimit, segmentsMemoryLimit int) ([]Segment, error) {
+
+	var valuesBuf = make([]T, bufferMemoryLimit)
+
+	var segments []Segment
+	var segmentBegin uint64 = 0
+	var err error
+	for err != io.EOF {
+		var count uint64
+		count, err = doReadAndSortFunc(r, w, less, stable, valuesBuf)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		segments = append(segments, Segment{segmentBegin, count})
+		segmentBegin += count
+
+		if 2*len(segments) > segmentsMemoryLimit {
+			return nil, ErrNotEnoughMemory
+		}
+	}
+
+	return segments, nil
+}
+
+func doReadAndSortFunc[T any](
+	r sortio.Reader[T],
+	w sortio.Writer[T],
+	less func(a, b T) bool,
+	stable bool,
+	valuesBuf []T) (uint64, error) {
+
+	var valuesRead = 0
+	for valuesRead < len(valuesBuf) {
+		value, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		valuesBuf[valuesRead] = value
+		valuesRead++
+	}
+
+	if valuesRead == 0 {
+		return 0, io.EOF
+	}
+
+	if stable {
+		sort.SliceStable(valuesBuf[:valuesRead], func(i, j int) bool { return less(valuesBuf[i], valuesBuf[j]) })
+	} else {
+		sort.Slice(valuesBuf[:valuesRead], func(i, j int) bool { return less(valuesBuf[i], valuesBuf[j]) })
+	}
+
+	for _, value := range valuesBuf[:valuesRead] {
+		err := w.Write(value)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err := w.Flush()
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(valuesRead), nil
+}
@@ -0,0 +1,223 @@
+package extsort
+
+import (
+	sortio "github.com/xosmig/extsort/io"
+	"io"
+)
+
+// A loser tree (tournament tree) is an alternative to the readers heap for the k-way merge.
+// The leaves are the current values of the readers and each internal node keeps the loser
+// of the match between the winners of its subtrees. When the winner is replaced by the next value
+// of its reader, only the path from its leaf to the root is replayed, which takes exactly
+// ceil(log2(k)) comparisons instead of up to 2*log2(k) comparisons of readersHeap.FixTop.
+//
+// The tree is stored in an array like a binary heap: the internal nodes are 1..k-1,
+// the leaf of reader i is node k+i, and the overall winner is stored in nodes[0].
+// The nodes keep the values of the losers along with the indices of their readers,
+// so that replaying a match does not need to look up the value of the loser elsewhere.
+// When a reader is exhausted, the tree is rebuilt for the remaining readers, which happens at most k times
+// and keeps the checks for exhausted readers out of the matches.
+// Ties are broken by the index of the reader, so the merge is stable:
+// among equal values, the values from the readers with smaller indices go first.
+
+// DoMultiwayMergeLoserTree is like DoMultiwayMerge, but it uses a loser tree instead of a heap.
+func DoMultiwayMergeLoserTree(readers []sortio.Uint64Reader, writer sortio.Uint64Writer) error {
+	var active []sortio.Uint64Reader // the readers, which are not exhausted, in the original order
+	var leaves []loserNodeUint64
+	for _, r := range readers {
+		value, err := r.ReadUint64()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		leaves = append(leaves, loserNodeUint64{value, len(active)})
+		active = append(active, r)
+	}
+
+	t := newLoserTreeUint64(leaves)
+	for len(t.nodes) > 0 {
+		winner := t.nodes[0]
+		err := writer.WriteUint64(winner.v)
+		if err != nil {
+			return err
+		}
+
+		value, err := active[winner.idx].ReadUint64()
+		if err == io.EOF {
+			active = append(active[:winner.idx], active[winner.idx+1:]...)
+			t = newLoserTreeUint64(t.leavesWithout(winner.idx))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		t.replay(loserNodeUint64{value, winner.idx})
+	}
+
+	return writer.Flush()
+}
+
+type loserNodeUint64 struct {
+	v   uint64
+	idx int // the index of the reader
+}
+
+type loserTreeUint64 struct {
+	nodes []loserNodeUint64
+}
+
+func newLoserTreeUint64(leaves []loserNodeUint64) *loserTreeUint64 {
+	t := &loserTreeUint64{nodes: make([]loserNodeUint64, len(leaves))}
+	if len(leaves) > 0 {
+		t.nodes[0] = t.build(1, leaves)
+	}
+	return t
+}
+
+// build fills the subtree of the node and returns its winner
+func (t *loserTreeUint64) build(node int, leaves []loserNodeUint64) loserNodeUint64 {
+	k := len(t.nodes)
+	if node >= k {
+		return leaves[node-k]
+	}
+
+	left, right := t.build(2*node, leaves), t.build(2*node+1, leaves)
+	if left.v < right.v || (left.v == right.v && left.idx < right.idx) {
+		t.nodes[node] = right
+		return left
+	}
+	t.nodes[node] = left
+	return right
+}
+
+// replay puts the new value of the reader of the last winner to the tree and updates the path to the root
+func (t *loserTreeUint64) replay(winner loserNodeUint64) {
+	for node := (winner.idx + len(t.nodes)) / 2; node > 0; node /= 2 {
+		loser := &t.nodes[node]
+		if loser.v < winner.v || (loser.v == winner.v && loser.idx < winner.idx) {
+			*loser, winner = winner, *loser
+		}
+	}
+	t.nodes[0] = winner
+}
+
+// leavesWithout returns the current values of all the readers except for the reader idx,
+// which is the winner, and renumbers the readers after it
+func (t *loserTreeUint64) leavesWithout(idx int) []loserNodeUint64 {
+	leaves := make([]loserNodeUint64, len(t.nodes))
+	for _, node := range t.nodes[1:] {
+		leaves[node.idx] = node
+	}
+	leaves = append(leaves[:idx], leaves[idx+1:]...)
+	for i := idx; i < len(leaves); i++ {
+		leaves[i].idx = i
+	}
+	return leaves
+}
+
+// DoMultiwayMergeLoserTreeFunc is a generic counterpart of DoMultiwayMergeLoserTree.
+// Values are ordered by the less function. Since ties are broken by the index of the reader,
+// it can be used instead of DoMultiwayMergeStableFunc as well.
+func DoMultiwayMergeLoserTreeFunc[T any](readers []sortio.Reader[T], writer sortio.Writer[T], less func(a, b T) bool) error {
+	var active []sortio.Reader[T]
+	var leaves []loserNodeOf[T]
+	for _, r := range readers {
+		value, err := r.Read()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		leaves = append(leaves, loserNodeOf[T]{value, len(active)})
+		active = append(active, r)
+	}
+
+	t := newLoserTreeFunc(leaves, less)
+	for len(t.nodes) > 0 {
+		winner := t.nodes[0]
+		err := writer.Write(winner.v)
+		if err != nil {
+			return err
+		}
+
+		value, err := active[winner.idx].Read()
+		if err == io.EOF {
+			active = append(active[:winner.idx], active[winner.idx+1:]...)
+			t = newLoserTreeFunc(t.leavesWithout(winner.idx), less)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		t.replay(loserNodeOf[T]{value, winner.idx})
+	}
+
+	return writer.Flush()
+}
+
+type loserNodeOf[T any] struct {
+	v   T
+	idx int
+}
+
+// loserTreeFunc is a generic counterpart of loserTreeUint64
+type loserTreeFunc[T any] struct {
+	nodes []loserNodeOf[T]
+	less  func(a, b T) bool
+}
+
+func newLoserTreeFunc[T any](leaves []loserNodeOf[T], less func(a, b T) bool) *loserTreeFunc[T] {
+	t := &loserTreeFunc[T]{nodes: make([]loserNodeOf[T], len(leaves)), less: less}
+	if len(leaves) > 0 {
+		t.nodes[0] = t.build(1, leaves)
+	}
+	return t
+}
+
+// beats reports whether a goes before b
+func (t *loserTreeFunc[T]) beats(a, b *loserNodeOf[T]) bool {
+	if a.idx < b.idx {
+		return !t.less(b.v, a.v)
+	}
+	return t.less(a.v, b.v)
+}
+
+func (t *loserTreeFunc[T]) build(node int, leaves []loserNodeOf[T]) loserNodeOf[T] {
+	k := len(t.nodes)
+	if node >= k {
+		return leaves[node-k]
+	}
+
+	left, right := t.build(2*node, leaves), t.build(2*node+1, leaves)
+	if t.beats(&left, &right) {
+		t.nodes[node] = right
+		return left
+	}
+	t.nodes[node] = left
+	return right
+}
+
+func (t *loserTreeFunc[T]) replay(winner loserNodeOf[T]) {
+	for node := (winner.idx + len(t.nodes)) / 2; node > 0; node /= 2 {
+		loser := &t.nodes[node]
+		if t.beats(loser, &winner) {
+			*loser, winner = winner, *loser
+		}
+	}
+	t.nodes[0] = winner
+}
+
+func (t *loserTreeFunc[T]) leavesWithout(idx int) []loserNodeOf[T] {
+	leaves := make([]loserNodeOf[T], len(t.nodes))
+	for _, node := range t.nodes[1:] {
+		leaves[node.idx] = node
+	}
+	leaves = append(leaves[:idx], leaves[idx+1:]...)
+	for i := idx; i < len(leaves); i++ {
+		leaves[i].idx = i
+	}
+	return leaves
+}
@@ -0,0 +1,156 @@
+package extsort
+
+import (
+	"context"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"log"
+	"runtime"
+)
+
+// DoMultiwayMergeInputsParamsContext merges the readers of sorted values to w without the first stage.
+// If there are more readers than the arity (see DefaultArity, which counts a buffer of BufferSize values
+// per reader), the readers are merged in several passes through temporary files like the segments
+// of the first stage. The values of each reader must be sorted in the order defined by params.Less.
+// At most arity readers are read at the same time, so the readers, which open their inputs and allocate their buffers
+// on the first read (see sortio.LazyUint64Reader), bound the number of open files and the memory by the arity.
+func DoMultiwayMergeInputsParamsContext(
+	ctx context.Context,
+	readers []sortio.Uint64Reader,
+	w sortio.Uint64Writer,
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	inputs := make([]sortio.Reader[uint64], len(readers))
+	for i, r := range readers {
+		inputs[i] = sortio.AsReader(r)
+	}
+	s := newSorter(ctx, params, uint64Ops(params), profiler)
+	defer s.close()
+	return s.mergeInputs(inputs, sortio.AsWriter(w))
+}
+
+// DoMultiwayMergeInputsFuncContext is a generic counterpart of DoMultiwayMergeInputsParamsContext.
+func DoMultiwayMergeInputsFuncContext[T any](
+	ctx context.Context,
+	readers []sortio.Reader[T],
+	w sortio.Writer[T],
+	codec sortio.Codec[T],
+	less func(a, b T) bool,
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	s := newSorter(ctx, params, funcOps(codec, less), profiler)
+	defer s.close()
+	return s.mergeInputs(readers, w)
+}
+
+// DoMultiwayMergeInputsRecordsContext merges the readers of sorted variable-length records
+// (see DoMultiwayMergeInputsParamsContext). Params are expressed in bytes.
+func DoMultiwayMergeInputsRecordsContext(
+	ctx context.Context,
+	readers []sortio.Reader[[]byte],
+	w sortio.Writer[[]byte],
+	less func(a, b []byte) bool,
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	s := newSorter(ctx, params, recordsOps(less), profiler)
+	defer s.close()
+	return s.mergeInputs(readers, w)
+}
+
+// countingWriter counts the values written to the temporary file of a segment
+type countingWriter[T any] struct {
+	sortio.Writer[T]
+	count uint64
+}
+
+func (w *countingWriter[T]) Write(x T) error {
+	w.count++
+	return w.Writer.Write(x)
+}
+
+// mergeInputs merges the sorted inputs to w. If there are more inputs than the arity, the inputs are split
+// into groups of adjacent inputs, which are merged to temporary files, and the files are merged by mergeAll.
+// Since the lengths of the inputs are unknown in advance, the groups have about the same number of inputs.
+// Adjacent groups keep the order of the inputs, so that the merge is stable in stable mode.
+// The groups are merged one after another, and the inputs of the next groups are not read until then.
+func (s *sorter[T]) mergeInputs(inputs []sortio.Reader[T], w sortio.Writer[T]) error {
+	err := s.validateParams()
+	if err != nil {
+		return err
+	}
+
+	if s.params.Arity == -1 {
+		s.params.Arity, err = DefaultArity(s.params, len(inputs))
+		if err != nil {
+			return err
+		}
+	}
+
+	readers := make([]sortio.Reader[T], len(inputs))
+	for i, r := range inputs {
+		readers[i] = withContext(s.ctx, r)
+	}
+
+	if len(readers) <= s.params.Arity {
+		log.Println("Running final merge...")
+		_, err = s.merge(readers, w, 0)
+		if err != nil {
+			return err
+		}
+		log.Println("Final merge done.")
+		return nil
+	}
+
+	log.Println("Merging the inputs to temporary files...")
+	groups := (len(readers) + s.params.Arity - 1) / s.params.Arity
+	segments := make([]sortSegment, 0, groups)
+	begin := 0
+	for i := 1; i <= groups; i++ {
+		end := len(readers) * i / groups
+		segment, err := s.mergeInputsToTmpFile(readers[begin:end])
+		if err != nil {
+			return err
+		}
+		segments = append(segments, segment)
+		s.inputOffset += segment.count
+		begin = end
+		runtime.GC()
+	}
+	log.Println("Merging the inputs done.")
+
+	err = s.saveCheckpoint(segments)
+	if err != nil {
+		return err
+	}
+
+	return s.mergeAll(segments, w)
+}
+
+// mergeInputsToTmpFile merges the readers into a new temporary file
+func (s *sorter[T]) mergeInputsToTmpFile(readers []sortio.Reader[T]) (sortSegment, error) {
+	if err := s.ctx.Err(); err != nil {
+		return sortSegment{}, err
+	}
+
+	filename, w, t, err := s.newTmpFileWriter()
+	if err != nil {
+		return sortSegment{}, err
+	}
+	defer t.Close()
+
+	counter := &countingWriter[T]{Writer: w}
+	_, err = s.merge(readers, counter, 0)
+	if err != nil {
+		return sortSegment{}, err
+	}
+
+	err = t.Finish()
+	if err != nil {
+		return sortSegment{}, err
+	}
+
+	return sortSegment{0, counter.count, filename}, nil
+}
@@ -0,0 +1,154 @@
+package extsort
+
+import (
+	"context"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// generateSortedInputs splits random values into the given number of inputs and sorts every input
+func generateSortedInputs(count int, inputsCount int, less func(a, b uint64) bool) [][]uint64 {
+	inputs := make([][]uint64, inputsCount)
+	for i := 0; i < count; i++ {
+		input := rand.Intn(inputsCount)
+		inputs[input] = append(inputs[input], rand.Uint64()%1000)
+	}
+	for _, input := range inputs {
+		sort.SliceStable(input, func(i, j int) bool { return less(input[i], input[j]) })
+	}
+	return inputs
+}
+
+func TestDoMultiwayMergeInputsParamsContext(t *testing.T) {
+	testcases := []struct {
+		name        string
+		inputsCount int
+		params      Params
+	}{
+		{"single", 1, Params{MemoryLimit: 1000, Arity: 3, ReserveMemoryForSegmentsInfo: 100,
+			FirstStageMemoryLimit: 10, BufferSize: 4}},
+		{"direct", 3, Params{MemoryLimit: 1000, Arity: 3, ReserveMemoryForSegmentsInfo: 100,
+			FirstStageMemoryLimit: 10, BufferSize: 4}},
+		{"one_more_than_arity", 4, Params{MemoryLimit: 1000, Arity: 3, ReserveMemoryForSegmentsInfo: 100,
+			FirstStageMemoryLimit: 10, BufferSize: 4}},
+		{"several_passes", 30, Params{MemoryLimit: 1000, Arity: 3, ReserveMemoryForSegmentsInfo: 100,
+			FirstStageMemoryLimit: 10, BufferSize: 4}},
+		{"default_arity", 30, Params{MemoryLimit: 330, Arity: -1, ReserveMemoryForSegmentsInfo: 100,
+			FirstStageMemoryLimit: 10, BufferSize: 4}},
+		{"descending", 30, Params{MemoryLimit: 1000, Arity: 3, ReserveMemoryForSegmentsInfo: 100,
+			FirstStageMemoryLimit: 10, BufferSize: 4, Less: Reverse(LessUnsigned)}},
+		{"compression_checksums_async", 30, Params{MemoryLimit: 1000, Arity: 3, ReserveMemoryForSegmentsInfo: 100,
+			FirstStageMemoryLimit: 10, BufferSize: 4, Compression: DeltaCompression, Checksums: true, AsyncIO: true}},
+		{"forecasting", 30, Params{MemoryLimit: 1000, Arity: 4, ReserveMemoryForSegmentsInfo: 100,
+			FirstStageMemoryLimit: 10, BufferSize: 4, Forecasting: true}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			less := tc.params.Less
+			if less == nil {
+				less = LessUnsigned
+			}
+			inputs := generateSortedInputs(1000, tc.inputsCount, less)
+
+			var readers []sortio.Uint64Reader
+			var expectedOutput []uint64
+			for _, input := range inputs {
+				readers = append(readers, sortio.NewSliceUint64Reader(input))
+				expectedOutput = append(expectedOutput, input...)
+			}
+			sort.Slice(expectedOutput, func(i, j int) bool { return less(expectedOutput[i], expectedOutput[j]) })
+
+			output := sortio.NewSliceUint64Writer()
+			err := DoMultiwayMergeInputsParamsContext(context.Background(), readers, output, tc.params,
+				util.NewNilSimpleProfiler())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(expectedOutput, output.Data()) {
+				t.Fatalf("expected: %v, actual: %v", expectedOutput, output.Data())
+			}
+		})
+	}
+}
+
+func TestDoMultiwayMergeInputsParamsContext_Stable(t *testing.T) {
+	values := generateValuesWithPositions(1000, 10)
+	// the inputs are adjacent parts of the values, so that the positions grow from one input to the next one
+	var readers []sortio.Uint64Reader
+	for begin := 0; begin < len(values); begin += 50 {
+		input := append([]uint64(nil), values[begin:begin+50]...)
+		sort.SliceStable(input, func(i, j int) bool { return lessHighBits(input[i], input[j]) })
+		readers = append(readers, sortio.NewSliceUint64Reader(input))
+	}
+
+	params := Params{
+		MemoryLimit:                  1000,
+		Arity:                        3,
+		ReserveMemoryForSegmentsInfo: 100,
+		FirstStageMemoryLimit:        10,
+		BufferSize:                   2,
+		Less:                         lessHighBits,
+		Stable:                       true,
+	}
+	output := sortio.NewSliceUint64Writer()
+	err := DoMultiwayMergeInputsParamsContext(context.Background(), readers, output, params,
+		util.NewNilSimpleProfiler())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	checkStablySorted(t, values, output.Data(), lessHighBits)
+}
+
+func TestDoMultiwayMergeInputsRecordsContext(t *testing.T) {
+	var readers []sortio.Reader[[]byte]
+	var expectedOutput [][]byte
+	for i := 0; i < 7; i++ {
+		input := generateRandomRecords(100)
+		sort.Slice(input, func(i, j int) bool { return LessBytes(input[i], input[j]) })
+		readers = append(readers, sortio.NewSliceReader(input))
+		expectedOutput = append(expectedOutput, input...)
+	}
+	sort.Slice(expectedOutput, func(i, j int) bool { return LessBytes(expectedOutput[i], expectedOutput[j]) })
+
+	params := Params{
+		MemoryLimit:                  1000,
+		Arity:                        2,
+		ReserveMemoryForSegmentsInfo: 100,
+		FirstStageMemoryLimit:        100,
+		BufferSize:                   16,
+	}
+	output := sortio.NewSliceWriter[[]byte]()
+	err := DoMultiwayMergeInputsRecordsContext(context.Background(), readers, output, LessBytes, params,
+		util.NewNilSimpleProfiler())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(expectedOutput, output.Data()) {
+		t.Fatalf("expected: %q, actual: %q", expectedOutput, output.Data())
+	}
+}
+
+func TestDoMultiwayMergeInputsParamsContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var readers []sortio.Uint64Reader
+	for _, input := range generateSortedInputs(100000, 10, LessUnsigned) {
+		readers = append(readers, sortio.NewSliceUint64Reader(input))
+	}
+	params := Params{MemoryLimit: 1000, Arity: 3, ReserveMemoryForSegmentsInfo: 100,
+		FirstStageMemoryLimit: 10, BufferSize: 4}
+	err := DoMultiwayMergeInputsParamsContext(ctx, readers, sortio.NewSliceUint64Writer(), params,
+		util.NewNilSimpleProfiler())
+	if err != context.Canceled {
+		t.Fatalf("expected %v, actual: %v", context.Canceled, err)
+	}
+}
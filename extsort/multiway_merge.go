@@ -119,6 +119,117 @@ func (h *readersHeap) FixTop() {
 	h.down(0, h.Len())
 }
 
+// DoMultiwayMergeFunc is a generic counterpart of DoMultiwayMerge. Values are ordered by the less function.
+func DoMultiwayMergeFunc[T any](readers []sortio.Reader[T], writer sortio.Writer[T], less func(a, b T) bool) error {
+	h := newReadersHeapFunc(len(readers), less)
+	for _, r := range readers {
+		value, err := r.Read()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		h.Push(readerValuePairOf[T]{r, value})
+	}
+
+	for h.Len() > 0 {
+		pair := h.Top()
+		err := writer.Write(pair.v)
+		if err != nil {
+			return err
+		}
+		value, err := pair.r.Read()
+		if err == io.EOF {
+			h.RemoveTop()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		pair.v = value
+		h.FixTop()
+	}
+
+	return writer.Flush()
+}
+
+type readerValuePairOf[T any] struct {
+	r sortio.Reader[T]
+	v T
+}
+
+// readersHeapFunc is a generic counterpart of readersHeap
+type readersHeapFunc[T any] struct {
+	data []readerValuePairOf[T]
+	less func(a, b T) bool
+}
+
+func newReadersHeapFunc[T any](cap int, less func(a, b T) bool) *readersHeapFunc[T] {
+	return &readersHeapFunc[T]{
+		data: make([]readerValuePairOf[T], 0, cap),
+		less: less,
+	}
+}
+
+func (h *readersHeapFunc[T]) Push(x readerValuePairOf[T]) {
+	h.data = append(h.data, x)
+	h.up(h.Len() - 1)
+}
+
+func (h *readersHeapFunc[T]) Top() *readerValuePairOf[T] {
+	return &h.data[0]
+}
+
+func (h *readersHeapFunc[T]) RemoveTop() {
+	n := h.Len() - 1
+	h.swap(0, n)
+	h.down(0, n)
+	h.data = h.data[:n]
+}
+
+func (h *readersHeapFunc[T]) swap(i, j int) {
+	h.data[i], h.data[j] = h.data[j], h.data[i]
+}
+
+func (h *readersHeapFunc[T]) Len() int {
+	return len(h.data)
+}
+
+func (h *readersHeapFunc[T]) up(j int) {
+	for {
+		i := (j - 1) / 2 // parent
+		if i == j || !h.less(h.data[j].v, h.data[i].v) {
+			break
+		}
+		h.swap(i, j)
+		j = i
+	}
+}
+
+func (h *readersHeapFunc[T]) down(i, n int) {
+	for {
+		j1 := 2*i + 1
+		if j1 >= n || j1 < 0 { // j1 < 0 after int overflow
+			break
+		}
+		j := j1 // left child
+		if j2 := j1 + 1; j2 < n && h.less(h.data[j2].v, h.data[j1].v) {
+			j = j2 // = 2*i + 2  // right child
+		}
+		if !h.less(h.data[j].v, h.data[i].v) {
+			break
+		}
+		h.swap(i, j)
+		i = j
+	}
+}
+
+func (h *readersHeapFunc[T]) FixTop() {
+	h.down(0, h.Len())
+}
+
 //func DoMultiwayMerge(readers []sortio.Uint64Reader, writer sortio.Uint64Writer) error {
 //	values := make([]uint64, len(readers))
 //
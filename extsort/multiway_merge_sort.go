@@ -1,17 +1,20 @@
 package extsort
 
 import (
+	"context"
+	"encoding/binary"
 	"errors"
-	"fmt"
 	sortio "github.com/xosmig/extsort/io"
 	"github.com/xosmig/extsort/util"
+	"io"
 	"log"
-	"math/rand"
 	"os"
 	"runtime"
+	"unsafe"
 )
 
 var ErrNotEnoughMemory = errors.New("not enough memory")
+var ErrNotSupported = errors.New("the requested combination of parameters is not supported")
 
 type ReplacementSelectionParams struct {
 }
@@ -23,6 +26,58 @@ type Params struct {
 	UseReplacementSelection      bool // InitialSort is used by default instead
 	ReserveMemoryForSegmentsInfo int  // expressed in values (1 value equals 8 bytes). This parameter only used by replacement selection algorithm
 	FirstStageMemoryLimit        int  // expressed in values (1 value equals 8 bytes)
+	// Less defines the order of values. The specialized ascending order is used if Less is nil.
+	// This parameter is only used for uint64 values, the generic functions take the order explicitly.
+	Less func(a, b uint64) bool `json:"-"`
+	// Stable preserves the input order of values which are equal according to the order of values.
+	// The in-memory sort is stable, and merge ties are broken by run index (earlier run wins).
+	// Replacement selection keeps a sequence number along with each value in memory in this mode.
+	// It has no effect for uint64 values in the default order, since equal values are indistinguishable.
+	Stable bool
+	// Unique drops the values equal to the previous value according to the order of values, so that the output
+	// contains every distinct value once. The values are dropped by the first stage and by every merge,
+	// so the temporary files shrink as well. In stable mode, the first of the equal values in the input is kept.
+	Unique bool
+	// Parallelism is the number of chunks sorted concurrently by the first stage.
+	// FirstStageMemoryLimit is split between the chunks. Values less than 2 mean sequential sorting.
+	// This parameter is ignored by replacement selection.
+	Parallelism int
+	// AsyncIO makes the temporary files read and written by background goroutines with double buffering.
+	// Each reader and writer of a temporary file uses 2 additional blocks of BufferSize values in this mode.
+	AsyncIO bool
+	// Forecasting makes the merge prefetch the next block of the segment, which will be exhausted first,
+	// on a background goroutine (see Knuth, TAOCP vol. 3, 5.4.6). It uses 1 additional block of BufferSize values
+	// per merge and takes precedence over AsyncIO for reading the segments.
+	// This parameter is ignored for variable-length records.
+	Forecasting bool
+	// UseLoserTree makes the merges use a loser tree instead of a heap. The loser tree does fewer comparisons
+	// per value (log2(k) instead of up to 2*log2(k)), which may pay off for large arities and expensive comparisons.
+	// For uint64 values, the heap is usually faster. See the merge benchmarks in multiway_merge_test.go.
+	UseLoserTree bool
+	// InMemorySort is the algorithm used by the first stage to sort the chunks of values.
+	// The scratch buffer of the algorithm is taken from FirstStageMemoryLimit.
+	// The radix sorts are only supported for uint64 values in the default order and ignored by replacement selection.
+	InMemorySort InMemorySort
+	// TempDirs are the directories for the temporary files. os.TempDir() is used if the list is empty.
+	// Putting the directories on different disks lets the merges read from several disks at once.
+	TempDirs []string
+	// TempDirPolicy defines how the temporary files are distributed across TempDirs.
+	TempDirPolicy TempDirPolicy
+	// Compression is the format of the temporary files. It is only supported for uint64 values.
+	// Each reader and writer of a compressed file uses 2 additional blocks of BufferSize values.
+	// Forecasting is not used for compressed files.
+	Compression Compression
+	// Checksums makes the temporary files store a CRC32C checksum of every block of BufferSize values,
+	// which is verified when the files are read. Each reader and writer of a temporary file uses 1 additional block.
+	// The raw format is used by default.
+	Checksums bool
+	// Checkpoint is the name of the file where the state of the sort is saved after the first stage and after
+	// every intermediate merge. The temporary files referenced by the checkpoint are kept if the sort fails,
+	// so that it can be continued by the Resume functions. The checkpoint and the files are removed on success.
+	Checkpoint string
+	// TempFileSync defines when the temporary files are synced to the disk. They are not synced by default,
+	// since they are useless after a crash. The files referenced by a checkpoint are synced before it is saved.
+	TempFileSync sortio.SyncPolicy
 }
 
 const DefaultBufferSize = sortio.DefaultBufValuesCount
@@ -42,6 +97,7 @@ func CreateParams(memoryLimit int, bufferSize int, useReplacementSelection bool)
 		UseReplacementSelection:      useReplacementSelection,
 		ReserveMemoryForSegmentsInfo: reserveMemoryForSegmentsInfo,
 		FirstStageMemoryLimit:        memoryLimit - 2*bufferSize - reserveMemoryForSegmentsInfo,
+		Parallelism:                  1,
 	}
 }
 
@@ -57,7 +113,26 @@ func ValidateParams(params Params) error {
 		return ErrValueTooSmall
 	}
 
-	return nil
+	return params.TempFileSync.Validate()
+}
+
+// TmpFileBufferSize returns the memory used by a reader or a writer of a temporary file (expressed in values):
+// the buffer of BufferSize values and the additional blocks of AsyncIO, Checksums and Compression.
+func TmpFileBufferSize(params Params) int {
+	bufferSize := params.BufferSize
+	if params.AsyncIO {
+		// the double buffering blocks
+		bufferSize += 2 * params.BufferSize
+	}
+	if params.Checksums {
+		// the block being verified or checksummed
+		bufferSize += params.BufferSize
+	}
+	if params.Compression != NoCompression {
+		// the encoded and compressed blocks
+		bufferSize += 2 * params.BufferSize
+	}
+	return bufferSize
 }
 
 func DefaultArity(params Params, segmentsCount int) (int, error) {
@@ -66,15 +141,22 @@ func DefaultArity(params Params, segmentsCount int) (int, error) {
 		return 0, err
 	}
 
+	bufferSize := TmpFileBufferSize(params)
+
 	memoryLeft := params.MemoryLimit
 	// reserve memory for the output buffer
-	memoryLeft -= params.BufferSize
+	memoryLeft -= bufferSize
+	if params.Forecasting {
+		// reserve memory for the spare block
+		memoryLeft -= params.BufferSize
+	}
 	// reserve memory for the segments
 	memoryLeft -= segmentsCount * 10
 	// calculate arity
-	arity := memoryLeft / params.BufferSize
+	arity := memoryLeft / bufferSize
 
-	if arity <= 0 {
+	// a merge needs at least 2 readers to make progress
+	if arity < 2 {
 		return 0, ErrNotEnoughMemory
 	}
 
@@ -86,19 +168,72 @@ func DoFirstStageParams(
 	w sortio.Uint64Writer,
 	params Params) ([]Segment, error) {
 
+	if params.Less != nil {
+		return DoFirstStageParamsFunc(sortio.AsReader(r), sortio.AsWriter(w), params.Less, params)
+	}
+	if params.Unique {
+		return doFirstStageUnique(sortio.AsWriter(w), LessUnsigned, nil, params,
+			func(w sortio.Writer[uint64], params Params) ([]Segment, error) {
+				return DoFirstStageParams(r, sortio.AsUint64Writer(w), params)
+			})
+	}
+
 	var segments []Segment
 	var err error
 
 	if params.UseReplacementSelection {
 		segments, err = DoReplacementSelection(r, w,
 			params.FirstStageMemoryLimit, params.ReserveMemoryForSegmentsInfo)
+	} else if params.Parallelism > 1 {
+		segments, err = DoInitialSortParallelAlgorithm(r, w, params.InMemorySort,
+			params.FirstStageMemoryLimit, params.ReserveMemoryForSegmentsInfo, params.Parallelism)
 	} else {
-		segments, err = DoInitialSort(r, w, params.FirstStageMemoryLimit, params.ReserveMemoryForSegmentsInfo)
+		segments, err = DoInitialSortAlgorithm(r, w, params.InMemorySort,
+			params.FirstStageMemoryLimit, params.ReserveMemoryForSegmentsInfo)
 	}
 
 	return segments, err
 }
 
+// DoFirstStageParamsFunc is a generic counterpart of DoFirstStageParams.
+func DoFirstStageParamsFunc[T any](
+	r sortio.Reader[T],
+	w sortio.Writer[T],
+	less func(a, b T) bool,
+	params Params) ([]Segment, error) {
+
+	if params.InMemorySort != ComparisonSort && !params.UseReplacementSelection {
+		// the radix sorts rely on the binary representation of uint64 values in the default order
+		return nil, ErrNotSupported
+	}
+	if params.Unique {
+		return doFirstStageUnique(w, less, nil, params, func(w sortio.Writer[T], params Params) ([]Segment, error) {
+			return DoFirstStageParamsFunc(r, w, less, params)
+		})
+	}
+
+	if params.Parallelism > 1 && !params.UseReplacementSelection {
+		return DoInitialSortParallelFunc(r, w, less, params.Stable,
+			params.FirstStageMemoryLimit, params.ReserveMemoryForSegmentsInfo, params.Parallelism)
+	}
+
+	if params.Stable {
+		if params.UseReplacementSelection {
+			// the heap contains values along with their sequence numbers
+			var zero T
+			heapMemoryLimit := params.FirstStageMemoryLimit * int(unsafe.Sizeof(zero)) / int(unsafe.Sizeof(sequenced[T]{}))
+			return DoReplacementSelectionStableFunc(r, w, less, heapMemoryLimit, params.ReserveMemoryForSegmentsInfo)
+		}
+		return DoInitialSortStableFunc(r, w, less, params.FirstStageMemoryLimit, params.ReserveMemoryForSegmentsInfo)
+	}
+
+	if params.UseReplacementSelection {
+		return DoReplacementSelectionFunc(r, w, less,
+			params.FirstStageMemoryLimit, params.ReserveMemoryForSegmentsInfo)
+	}
+	return DoInitialSortFunc(r, w, less, params.FirstStageMemoryLimit, params.ReserveMemoryForSegmentsInfo)
+}
+
 func DoMultiwayMergeSort(
 	r sortio.Uint64Reader,
 	w sortio.Uint64Writer,
@@ -114,51 +249,274 @@ func DoMultiwayMergeSortParams(
 	params Params,
 	profiler *util.SimpleProfiler) error {
 
-	s := sorter{
-		params:   params,
-		byteBuf:  sortio.NewUint64ByteBuf(params.BufferSize),
-		profiler: profiler,
-	}
+	return DoMultiwayMergeSortParamsContext(context.Background(), r, w, params, profiler)
+}
+
+// DoMultiwayMergeSortParamsContext is like DoMultiwayMergeSortParams, but it stops soon after the context
+// is cancelled, removes the temporary files and returns ctx.Err().
+func DoMultiwayMergeSortParamsContext(
+	ctx context.Context,
+	r sortio.Uint64Reader,
+	w sortio.Uint64Writer,
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	s := newSorter(ctx, params, uint64Ops(params), profiler)
+	defer s.close()
+	return s.doSort(sortio.AsReader(r), sortio.AsWriter(w))
+}
+
+// DoMultiwayMergeSortFunc is a generic counterpart of DoMultiwayMergeSortParams.
+// The codec is used to store values in the temporary files, and values are ordered by the less function.
+// Params are expressed in values of type T rather than in 8-byte values.
+func DoMultiwayMergeSortFunc[T any](
+	r sortio.Reader[T],
+	w sortio.Writer[T],
+	codec sortio.Codec[T],
+	less func(a, b T) bool,
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	return DoMultiwayMergeSortFuncContext(context.Background(), r, w, codec, less, params, profiler)
+}
+
+// DoMultiwayMergeSortFuncContext is a generic counterpart of DoMultiwayMergeSortParamsContext.
+func DoMultiwayMergeSortFuncContext[T any](
+	ctx context.Context,
+	r sortio.Reader[T],
+	w sortio.Writer[T],
+	codec sortio.Codec[T],
+	less func(a, b T) bool,
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	s := newSorter(ctx, params, funcOps(codec, less), profiler)
 	defer s.close()
 	return s.doSort(r, w)
 }
 
-type sorter struct {
+// sortOps holds the type-specific parts of the sorting algorithm
+type sortOps[T any] struct {
+	// valueSize is the number of bytes per unit of Segment.Begin and Params.BufferSize
+	valueSize int
+	// firstStage writes the sorted runs to w and returns them as segments. It must flush w at the end of every
+	// segment, so that the writers, which transform the values, know where the segments begin
+	// (see seekableWriter and uniqueWriter). The records are an exception, their segments begin at byte offsets.
+	firstStage func(r sortio.Reader[T], w sortio.Writer[T], params Params) ([]Segment, error)
+	merge      func(readers []sortio.Reader[T], w sortio.Writer[T], params Params) error
+	newReader  func(r io.Reader, count int, buf []byte, length uint64) sortio.Reader[T]
+	newWriter  func(w sortio.WriteSyncer, count int, buf []byte) sortio.Writer[T]
+	// codec is used by the forecasting merge. It is nil if forecasting is not supported.
+	codec sortio.Codec[T]
+	// less is used by the forecasting merge and to find the equal values in the unique mode
+	less func(a, b T) bool
+	// combine is used instead of dropping the equal values in the unique mode if it is set (see uniqueWriter)
+	combine func(a, b T) T
+	// newCompressedReader and newCompressedWriter are used if Params.Compression is set.
+	// They are nil if compression is not supported.
+	newCompressedReader func(r io.Reader, count int, compression Compression, length uint64) sortio.Reader[T]
+	newCompressedWriter func(w sortio.WriteSyncer, count int, compression Compression) sortio.Writer[T]
+}
+
+// uint64Ops uses the specialized uint64 implementations, which are faster than the generic ones.
+// The temporary files store the values in the native byte order.
+func uint64Ops(params Params) sortOps[uint64] {
+	if params.Less != nil {
+		ops := funcOps[uint64](sortio.NativeUint64Codec{}, params.Less)
+		ops.newReader = newUint64SegmentReader
+		ops.newWriter = newUint64TmpWriter
+		ops.newCompressedReader = newCompressedUint64SegmentReader
+		ops.newCompressedWriter = newCompressedUint64TmpWriter
+		return ops
+	}
+
+	return sortOps[uint64]{
+		valueSize: sortio.SizeOfValue,
+		firstStage: func(r sortio.Reader[uint64], w sortio.Writer[uint64], params Params) ([]Segment, error) {
+			return DoFirstStageParams(sortio.AsUint64Reader(r), sortio.AsUint64Writer(w), params)
+		},
+		merge: func(readers []sortio.Reader[uint64], w sortio.Writer[uint64], params Params) error {
+			uint64Readers := make([]sortio.Uint64Reader, len(readers))
+			for i, r := range readers {
+				uint64Readers[i] = sortio.AsUint64Reader(r)
+			}
+			if params.UseLoserTree {
+				return DoMultiwayMergeLoserTree(uint64Readers, sortio.AsUint64Writer(w))
+			}
+			return DoMultiwayMerge(uint64Readers, sortio.AsUint64Writer(w))
+		},
+		newReader:           newUint64SegmentReader,
+		newWriter:           newUint64TmpWriter,
+		codec:               sortio.NativeUint64Codec{},
+		less:                LessUnsigned,
+		newCompressedReader: newCompressedUint64SegmentReader,
+		newCompressedWriter: newCompressedUint64TmpWriter,
+	}
+}
+
+func newUint64SegmentReader(r io.Reader, count int, buf []byte, length uint64) sortio.Reader[uint64] {
+	reader := sortio.NewBinaryUint64ReaderCountBufOrder(r, count, buf, binary.NativeEndian)
+	return sortio.NewBoundedUint64Reader(reader, length)
+}
+
+func newUint64TmpWriter(w sortio.WriteSyncer, count int, buf []byte) sortio.Writer[uint64] {
+	return sortio.NewBinaryUint64WriterCountBufOrder(w, count, buf, binary.NativeEndian)
+}
+
+func funcOps[T any](codec sortio.Codec[T], less func(a, b T) bool) sortOps[T] {
+	return sortOps[T]{
+		valueSize: codec.Size(),
+		firstStage: func(r sortio.Reader[T], w sortio.Writer[T], params Params) ([]Segment, error) {
+			return DoFirstStageParamsFunc(r, w, less, params)
+		},
+		merge: func(readers []sortio.Reader[T], w sortio.Writer[T], params Params) error {
+			return doMultiwayMergeParamsFunc(readers, w, less, params)
+		},
+		newReader: func(r io.Reader, count int, buf []byte, length uint64) sortio.Reader[T] {
+			return sortio.NewBoundedReader[T](sortio.NewBinaryReaderCountBuf(r, codec, count, buf), length)
+		},
+		newWriter: func(w sortio.WriteSyncer, count int, buf []byte) sortio.Writer[T] {
+			return sortio.NewBinaryWriterCountBuf(w, codec, count, buf)
+		},
+		codec: codec,
+		less:  less,
+	}
+}
+
+// doMultiwayMergeParamsFunc merges the readers with the merge implementation requested by params
+func doMultiwayMergeParamsFunc[T any](
+	readers []sortio.Reader[T],
+	w sortio.Writer[T],
+	less func(a, b T) bool,
+	params Params) error {
+
+	if params.UseLoserTree {
+		// the loser tree is stable by itself
+		return DoMultiwayMergeLoserTreeFunc(readers, w, less)
+	}
+	if params.Stable {
+		return DoMultiwayMergeStableFunc(readers, w, less)
+	}
+	return DoMultiwayMergeFunc(readers, w, less)
+}
+
+type sorter[T any] struct {
+	ctx      context.Context
 	params   Params
+	ops      sortOps[T]
 	byteBuf  []byte
+	tmpDirs  *tempDirs
 	tmpFiles []string
 	profiler *util.SimpleProfiler
+	// the state saved to the checkpoint (see Params.Checkpoint)
+	persisted   map[string]struct{}
+	inputOffset uint64
+	merges      int
 }
 
-func (s *sorter) newTmpFile() string {
-	filename := fmt.Sprintf("sort_tmp_%v", rand.Uint32())
-	s.tmpFiles = append(s.tmpFiles, filename)
-	return filename
+func newSorter[T any](ctx context.Context, params Params, ops sortOps[T], profiler *util.SimpleProfiler) *sorter[T] {
+	return &sorter[T]{
+		ctx:       ctx,
+		params:    params,
+		ops:       ops,
+		byteBuf:   make([]byte, params.BufferSize*ops.valueSize),
+		tmpDirs:   newTempDirs(params.TempDirs, params.TempDirPolicy),
+		profiler:  profiler,
+		persisted: make(map[string]struct{}),
+	}
 }
 
-func (s *sorter) newTmpFileWriter() (filename string, w sortio.Uint64Writer, f *os.File, err error) {
-	filename = s.newTmpFile()
-	f, err = os.Create(filename)
+func (s *sorter[T]) newTmpFile() (*os.File, error) {
+	f, err := s.tmpDirs.CreateTemp()
+	if err != nil {
+		return nil, err
+	}
+	s.tmpFiles = append(s.tmpFiles, f.Name())
+	return f, nil
+}
+
+// tmpFile is a temporary file opened for writing.
+// Finish must be called after the data is flushed to make sure that all the data is written.
+type tmpFile struct {
+	f        *os.File
+	sync     *sortio.SyncWriter
+	async    *sortio.AsyncWriter
+	checksum *sortio.ChecksumWriter
+}
+
+func (t *tmpFile) Finish() error {
+	var err error
+	if t.checksum != nil {
+		err = t.checksum.Close()
+	}
+	if t.async != nil {
+		if asyncErr := t.async.Close(); err == nil {
+			err = asyncErr
+		}
+	}
+	if syncErr := t.sync.Close(); err == nil {
+		err = syncErr
+	}
+	return err
+}
+
+func (t *tmpFile) Close() error {
+	t.Finish()
+	return t.f.Close()
+}
+
+func (s *sorter[T]) newTmpFileWriter() (filename string, w sortio.Writer[T], t *tmpFile, err error) {
+	f, err := s.newTmpFile()
 	if err != nil {
 		return
 	}
+	filename = f.Name()
+
+	t = &tmpFile{f: f, sync: sortio.NewSyncWriter(f, s.params.TempFileSync)}
+	var stream sortio.WriteSyncer = t.sync
+	if s.params.AsyncIO {
+		t.async = sortio.NewAsyncWriterSize(stream, s.params.BufferSize*s.ops.valueSize)
+		stream = t.async
+	}
+	if s.params.Checksums {
+		t.checksum = sortio.NewChecksumWriterSize(stream, s.params.BufferSize*s.ops.valueSize)
+		stream = t.checksum
+	}
 
-	w = sortio.NewBinaryUint64WriterCountBuf(f, s.params.BufferSize, s.byteBuf)
+	if s.params.Compression != NoCompression {
+		w = s.ops.newCompressedWriter(stream, s.params.BufferSize, s.params.Compression)
+	} else {
+		w = s.ops.newWriter(stream, s.params.BufferSize, s.byteBuf)
+	}
 	w.SetProfiler(s.profiler)
 	return
 }
 
-func (s *sorter) close() {
+// segmentFile is a temporary file opened for reading a segment
+type segmentFile struct {
+	f     *os.File
+	async *sortio.AsyncReader
+}
+
+func (sf *segmentFile) Close() error {
+	if sf.async != nil {
+		sf.async.Close()
+	}
+	return sf.f.Close()
+}
+
+func (s *sorter[T]) close() {
 	for _, filename := range s.tmpFiles {
-		os.Remove(filename)
+		s.tmpDirs.Remove(filename)
 	}
+	s.tmpDirs.Close()
 }
 
 func bToMb(b uint64) uint64 {
 	return b / 1024 / 1024
 }
 
-func (s *sorter) logMemoryUsage(msg string) {
+func (s *sorter[T]) logMemoryUsage(msg string) {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 	// For info on each, see: https://golang.org/pkg/runtime/#MemStats
@@ -170,16 +528,29 @@ func (s *sorter) logMemoryUsage(msg string) {
 		m.NumGC)
 }
 
-func (s *sorter) doSort(r sortio.Uint64Reader, w sortio.Uint64Writer) error {
+// validateParams checks that the parameters are supported for the type of values
+func (s *sorter[T]) validateParams() error {
 	err := ValidateParams(s.params)
 	if err != nil {
 		return err
 	}
 
+	if s.params.Compression != NoCompression && s.ops.newCompressedWriter == nil {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+func (s *sorter[T]) doSort(r sortio.Reader[T], w sortio.Writer[T]) error {
+	err := s.validateParams()
+	if err != nil {
+		return err
+	}
+
 	log.Println("Running first stage...")
 	runtime.GC()
 	s.logMemoryUsage("Memory usage before fist stage")
-	segmentsHeap, err := s.runFirstStage(r)
+	segments, err := s.runFirstStage(withContext(s.ctx, r))
 	if err != nil {
 		return err
 	}
@@ -187,13 +558,45 @@ func (s *sorter) doSort(r sortio.Uint64Reader, w sortio.Uint64Writer) error {
 	runtime.GC()
 	log.Println("First stage done.")
 
+	for _, segment := range segments {
+		s.inputOffset += segment.count
+	}
+	err = s.saveCheckpoint(segments)
+	if err != nil {
+		return err
+	}
+
+	return s.mergeAll(segments, w)
+}
+
+// mergeAll merges the segments produced by the first stage or restored from a checkpoint to w
+func (s *sorter[T]) mergeAll(segments []sortSegment, w sortio.Writer[T]) error {
+	var err error
 	if s.params.Arity == -1 {
-		s.params.Arity, err = DefaultArity(s.params, segmentsHeap.Len())
+		s.params.Arity, err = DefaultArity(s.params, len(segments))
 		if err != nil {
 			return err
 		}
 	}
 
+	if s.params.Stable {
+		err = s.mergeInInputOrder(segments, w)
+	} else {
+		err = s.mergeSmallestFirst(segments, w)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.removeCheckpoint()
+	return nil
+}
+
+// mergeSmallestFirst merges the smallest segments first (Huffman-like), so that the total amount of I/O is minimal.
+func (s *sorter[T]) mergeSmallestFirst(segments []sortSegment, w sortio.Writer[T]) error {
+	var err error
+	segmentsHeap := newSortSegmentsHeap(segments)
+
 	if segmentsHeap.Len() > s.params.Arity {
 		firstMergeArity := (segmentsHeap.Len()-1)%(s.params.Arity-1) + 1
 		if firstMergeArity > 1 {
@@ -234,47 +637,138 @@ func (s *sorter) doSort(r sortio.Uint64Reader, w sortio.Uint64Writer) error {
 	return nil
 }
 
-func (s *sorter) runFirstStage(r sortio.Uint64Reader) (sortSegmentsHeap, error) {
-	filename, w, f, err := s.newTmpFileWriter()
+// mergeInInputOrder only merges adjacent segments and keeps them in the order of the input,
+// so that the merge preserves the relative order of equal values (see Params.Stable).
+func (s *sorter[T]) mergeInInputOrder(segments []sortSegment, w sortio.Writer[T]) error {
+	log.Println("Running intermediate merge sort...")
+	for len(segments) > s.params.Arity {
+		var merged []sortSegment
+		for begin := 0; begin < len(segments); begin += s.params.Arity {
+			end := begin + s.params.Arity
+			if end > len(segments) {
+				end = len(segments)
+			}
+
+			if end-begin == 1 {
+				merged = append(merged, segments[begin])
+				continue
+			}
+
+			segment, err := s.mergeSegments(segments[begin:end])
+			if err != nil {
+				return err
+			}
+			merged = append(merged, segment)
+		}
+		if err := s.saveCheckpoint(merged); err != nil {
+			return err
+		}
+		segments = merged
+		runtime.GC()
+	}
+	log.Println("Intermediate merge sort done.")
+
+	log.Println("Running final merge...")
+	_, err := s.mergeSegmentsTo(segments, w)
+	if err != nil {
+		return err
+	}
+	log.Println("Final merge done.")
+
+	return nil
+}
+
+func (s *sorter[T]) runFirstStage(r sortio.Reader[T]) ([]sortSegment, error) {
+	filename, w, t, err := s.newTmpFileWriter()
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+
+	segments, err := s.ops.firstStage(r, w, s.params)
 	if err != nil {
-		return sortSegmentsHeap{}, err
+		return nil, err
 	}
-	defer f.Close()
 
-	segments, err := DoFirstStageParams(r, w, s.params)
+	err = t.Finish()
 	if err != nil {
-		return sortSegmentsHeap{}, err
+		return nil, err
 	}
 
 	var sortSegments []sortSegment
 	for _, segment := range segments {
-		sortSegments = append(sortSegments, sortSegment{segment.Begin, segment.Length, filename})
+		offset := int64(segment.Begin) * int64(s.ops.valueSize)
+		if seekable, ok := w.(seekableWriter); ok {
+			// see the requirements of sortOps.firstStage
+			if offset, ok = seekable.SeekOffset(segment.Begin); !ok {
+				return nil, ErrNotSupported
+			}
+		}
+		sortSegments = append(sortSegments, sortSegment{offset, segment.Length, filename})
 	}
 
-	return newSortSegmentsHeap(sortSegments), nil
+	return sortSegments, nil
 }
 
-func (s *sorter) mergeSmallestSegments(h *sortSegmentsHeap, n int) error {
-	filename, w, f, err := s.newTmpFileWriter()
+func (s *sorter[T]) mergeSmallestSegments(h *sortSegmentsHeap, n int) error {
+	segment, err := s.mergeSegments(popSegments(h, n))
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	outputLength, err := s.mergeSmallestSegmentsTo(h, n, w)
+	h.HPush(segment)
+	return s.saveCheckpoint(*h.impl)
+}
+
+// mergeSegments merges the segments into a new temporary file
+func (s *sorter[T]) mergeSegments(segments []sortSegment) (sortSegment, error) {
+	filename, w, t, err := s.newTmpFileWriter()
 	if err != nil {
-		return err
+		return sortSegment{}, err
 	}
+	defer t.Close()
 
-	h.HPush(sortSegment{0, outputLength, filename})
-	return nil
+	outputLength, err := s.mergeSegmentsTo(segments, w)
+	if err != nil {
+		return sortSegment{}, err
+	}
+
+	err = t.Finish()
+	if err != nil {
+		return sortSegment{}, err
+	}
+
+	s.merges++
+	return sortSegment{0, outputLength, filename}, nil
+}
+
+func popSegments(h *sortSegmentsHeap, n int) []sortSegment {
+	segments := make([]sortSegment, n)
+	for i := range segments {
+		segments[i] = h.HPop()
+	}
+	return segments
+}
+
+func (s *sorter[T]) mergeSmallestSegmentsTo(h *sortSegmentsHeap, n int, w sortio.Writer[T]) (uint64, error) {
+	return s.mergeSegmentsTo(popSegments(h, n), w)
 }
 
-func (s *sorter) mergeSmallestSegmentsTo(h *sortSegmentsHeap, n int, w sortio.Uint64Writer) (uint64, error) {
-	var readers []sortio.Uint64Reader
+// mergeSegmentsTo merges the segments to w. In stable mode, ties are broken by the order of the segments.
+func (s *sorter[T]) mergeSegmentsTo(segments []sortSegment, w sortio.Writer[T]) (uint64, error) {
+	// check the context between the merges in addition to the checks in the merge loops
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if s.params.Forecasting && s.ops.codec != nil && s.params.Compression == NoCompression {
+		return s.mergeSegmentsForecastingTo(segments, w)
+	}
+
+	var readers []sortio.Reader[T]
 	var outputLength uint64 = 0
-	for i := 0; i < n; i++ {
-		segment := h.HPop()
+	for i := range segments {
+		segment := segments[i]
 		r, f, err := s.getSegmentReader(&segment)
 		if err != nil {
 			return 0, err
@@ -285,22 +779,84 @@ func (s *sorter) mergeSmallestSegmentsTo(h *sortSegmentsHeap, n int, w sortio.Ui
 		outputLength += segment.count
 	}
 
-	err := DoMultiwayMerge(readers, w)
-	if err != nil {
-		return 0, err
+	return s.merge(readers, w, outputLength)
+}
+
+// merge merges the readers with the given total number of values to w and returns the number of values written,
+// which is less than the length if equal values are dropped (see Params.Unique)
+func (s *sorter[T]) merge(readers []sortio.Reader[T], w sortio.Writer[T], length uint64) (uint64, error) {
+	if !s.params.Unique {
+		return length, s.ops.merge(readers, w, s.params)
 	}
 
-	return outputLength, nil
+	unique := newUniqueWriter(w, s.ops.less, s.ops.combine)
+	err := s.ops.merge(readers, unique, s.params)
+	return unique.written, err
 }
 
-func (s *sorter) getSegmentReader(segment *sortSegment) (sortio.Uint64Reader, *os.File, error) {
-	f, err := segment.Open()
+// openSegment opens the file of the segment and returns the stream of the segment data
+func (s *sorter[T]) openSegment(segment *sortSegment) (io.Reader, *os.File, error) {
+	if !s.params.Checksums {
+		f, err := segment.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		return f, f, nil
+	}
+
+	f, err := os.Open(segment.filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	stream, err := sortio.NewChecksumReaderAt(f, segment.filename, s.params.BufferSize*s.ops.valueSize, segment.offset)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return stream, f, nil
+}
+
+func (s *sorter[T]) getSegmentReader(segment *sortSegment) (sortio.Reader[T], *segmentFile, error) {
+	stream, f, err := s.openSegment(segment)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	binaryReader := sortio.NewBinaryUint64ReaderCountBuf(f, s.params.BufferSize, s.byteBuf)
-	reader := sortio.NewBoundedUint64Reader(binaryReader, segment.count)
+	sf := &segmentFile{f: f}
+	if s.params.AsyncIO {
+		sf.async = sortio.NewAsyncReaderSize(stream, s.params.BufferSize*s.ops.valueSize)
+		stream = sf.async
+	}
+
+	var reader sortio.Reader[T]
+	if s.params.Compression != NoCompression {
+		reader = s.ops.newCompressedReader(stream, s.params.BufferSize, s.params.Compression, segment.count)
+	} else {
+		reader = s.ops.newReader(stream, s.params.BufferSize, s.byteBuf, segment.count)
+	}
 	reader.SetProfiler(s.profiler)
-	return reader, f, nil
+	return withContext(s.ctx, reader), sf, nil
+}
+
+// mergeSegmentsForecastingTo is like mergeSegmentsTo, but the segments are read with forecasting (see Params.Forecasting).
+func (s *sorter[T]) mergeSegmentsForecastingTo(segments []sortSegment, w sortio.Writer[T]) (uint64, error) {
+	forecaster := newForecaster(s.ops.codec, s.ops.less, s.params.BufferSize, s.byteBuf, s.profiler)
+
+	var readers []sortio.Reader[T]
+	var outputLength uint64 = 0
+	for i := range segments {
+		segment := segments[i]
+		stream, f, err := s.openSegment(&segment)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close() // disregard the warning about defer in a for loop
+
+		readers = append(readers, withContext(s.ctx, forecaster.AddReader(stream, segment.count)))
+		outputLength += segment.count
+	}
+	// the background read must be finished before the files are closed
+	defer forecaster.Close()
+
+	return s.merge(readers, w, outputLength)
 }
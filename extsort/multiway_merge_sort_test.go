@@ -1,10 +1,14 @@
 package extsort
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	sortio "github.com/xosmig/extsort/io"
 	"github.com/xosmig/extsort/util"
 	"log"
 	"math/rand"
+	"os"
 	"reflect"
 	"sort"
 	"testing"
@@ -40,6 +44,182 @@ func TestDoMultiwayMergeSort(t *testing.T) {
 			},
 			name: "small_replacementSelection",
 		},
+		{
+			inputData: []uint64{2326, 141, 15, 824, 2, 1882, 344, 152, 85, 5, 123, 123, 1, 268, 1023, 9652},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        3,
+				BufferSize:                   1,
+				UseReplacementSelection:      false,
+				Less:                         Reverse(LessUnsigned),
+			},
+			name: "small_initialSort_descending",
+		},
+		{
+			inputData: []uint64{2326, 1 << 63, 15, 824, 2, 1882, ^uint64(0), 152, 85, 5, 123, 123, 1, ^uint64(5), 1023, 9652},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        3,
+				BufferSize:                   1,
+				UseReplacementSelection:      true,
+				Less:                         LessSigned,
+			},
+			name: "small_replacementSelection_signed",
+		},
+		{
+			inputData: []uint64{2326, 141, 15, 824, 2, 1882, 344, 152, 85, 5, 123, 123, 1, 268, 1023, 9652},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        3,
+				BufferSize:                   1,
+				UseReplacementSelection:      false,
+				AsyncIO:                      true,
+			},
+			name: "small_initialSort_asyncIO",
+		},
+		{
+			inputData: []uint64{2326, 141, 15, 824, 2, 1882, 344, 152, 85, 5, 123, 123, 1, 268, 1023, 9652},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        3,
+				BufferSize:                   2,
+				UseReplacementSelection:      false,
+				Forecasting:                  true,
+			},
+			name: "small_initialSort_forecasting",
+		},
+		{
+			inputData: []uint64{2326, 141, 15, 824, 2, 1882, 344, 152, 85, 5, 123, 123, 1, 268, 1023, 9652},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        3,
+				BufferSize:                   2,
+				UseReplacementSelection:      true,
+				Less:                         Reverse(LessUnsigned),
+				Forecasting:                  true,
+			},
+			name: "small_replacementSelection_descending_forecasting",
+		},
+		{
+			inputData: []uint64{2326, 141, 15, 824, 2, 1882, 344, 152, 85, 5, 123, 123, 1, 268, 1023, 9652},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        3,
+				BufferSize:                   1,
+				UseReplacementSelection:      false,
+				UseLoserTree:                 true,
+			},
+			name: "small_initialSort_loserTree",
+		},
+		{
+			inputData: []uint64{2326, 1 << 63, 15, 824, 2, 1882, ^uint64(0), 152, 85, 5, 123, 123, 1, ^uint64(5), 1023, 9652},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        3,
+				BufferSize:                   1,
+				UseReplacementSelection:      false,
+				Less:                         LessSigned,
+				UseLoserTree:                 true,
+			},
+			name: "small_initialSort_signed_loserTree",
+		},
+		{
+			inputData: []uint64{2326, 141, 15, 824, 2, 1882, 344, 152, 85, 5, 123, 123, 1, 268, 1023, 9652},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        3,
+				BufferSize:                   2,
+				UseReplacementSelection:      false,
+				Checksums:                    true,
+			},
+			name: "small_initialSort_checksums",
+		},
+		{
+			inputData: []uint64{2326, 141, 15, 824, 2, 1882, 344, 152, 85, 5, 123, 123, 1, 268, 1023, 9652},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        3,
+				BufferSize:                   2,
+				UseReplacementSelection:      true,
+				Less:                         Reverse(LessUnsigned),
+				Forecasting:                  true,
+				Checksums:                    true,
+			},
+			name: "small_replacementSelection_descending_forecasting_checksums",
+		},
+		{
+			inputData: []uint64{2326, 141, 15, 824, 2, 1882, 344, 152, 85, 5, 123, 123, 1, 268, 1023, 9652},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        3,
+				BufferSize:                   2,
+				UseReplacementSelection:      false,
+				AsyncIO:                      true,
+				Checksums:                    true,
+			},
+			name: "small_initialSort_asyncIO_checksums",
+		},
+		{
+			inputData: []uint64{2326, 141, 15, 824, 2, 1882, 344, 152, 85, 5, 123, 123, 1, 268, 1023, 9652},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        3,
+				BufferSize:                   2,
+				UseReplacementSelection:      false,
+				Compression:                  DeltaCompression,
+			},
+			name: "small_initialSort_deltaCompression",
+		},
+		{
+			inputData: []uint64{2326, 141, 15, 824, 2, 1882, 344, 152, 85, 5, 123, 123, 1, 268, 1023, 9652},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        3,
+				BufferSize:                   2,
+				UseReplacementSelection:      true,
+				Compression:                  FlateCompression,
+			},
+			name: "small_replacementSelection_flateCompression",
+		},
+		{
+			inputData: []uint64{2326, 141, 15, 824, 2, 1882, 344, 152, 85, 5, 123, 123, 1, 268, 1023, 9652},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        3,
+				BufferSize:                   2,
+				UseReplacementSelection:      true,
+				Less:                         LessSigned,
+				Compression:                  DeltaCompression,
+				Checksums:                    true,
+			},
+			name: "small_replacementSelection_signed_deltaCompression_checksums",
+		},
 		{
 			inputData: generateRandomArray(10 * 1024 * 1024),
 			params:    DefaultParams(1024 * 1024),
@@ -50,6 +230,44 @@ func TestDoMultiwayMergeSort(t *testing.T) {
 			params:    CreateParams(1024*1024, DefaultBufferSize, true),
 			name:      "10M_randomValues_replacementSelection",
 		},
+		{
+			inputData: generateRandomArray(1024 * 1024),
+			params: Params{
+				MemoryLimit:                  4000,
+				Arity:                        -1,
+				ReserveMemoryForSegmentsInfo: 10000,
+				FirstStageMemoryLimit:        10000,
+				BufferSize:                   64,
+				Forecasting:                  true,
+			},
+			name: "1M_randomValues_forecasting",
+		},
+		{
+			inputData: generateRandomArray(1024 * 1024),
+			params: Params{
+				MemoryLimit:                  4000,
+				Arity:                        -1,
+				ReserveMemoryForSegmentsInfo: 10000,
+				FirstStageMemoryLimit:        10000,
+				BufferSize:                   64,
+				Checksums:                    true,
+			},
+			name: "1M_randomValues_checksums",
+		},
+		{
+			inputData: generateRandomArray(1024 * 1024),
+			params: Params{
+				MemoryLimit:                  4000,
+				Arity:                        -1,
+				ReserveMemoryForSegmentsInfo: 10000,
+				FirstStageMemoryLimit:        10000,
+				BufferSize:                   64,
+				Parallelism:                  2,
+				AsyncIO:                      true,
+				Compression:                  DeltaCompression,
+			},
+			name: "1M_randomValues_parallel_asyncIO_deltaCompression",
+		},
 	}
 
 	for _, tc := range testcases {
@@ -64,7 +282,11 @@ func TestDoMultiwayMergeSort(t *testing.T) {
 
 			expectedOutput := make([]uint64, len(tc.inputData))
 			copy(expectedOutput, tc.inputData)
-			sort.Slice(expectedOutput, func(i, j int) bool { return expectedOutput[i] < expectedOutput[j] })
+			less := tc.params.Less
+			if less == nil {
+				less = LessUnsigned
+			}
+			sort.Slice(expectedOutput, func(i, j int) bool { return less(expectedOutput[i], expectedOutput[j]) })
 
 			if len(expectedOutput) != len(output.Data()) {
 				t.Fatalf("expected output length: %v, actual: %v", len(expectedOutput), len(output.Data()))
@@ -81,6 +303,129 @@ func TestDoMultiwayMergeSort(t *testing.T) {
 	}
 }
 
+func TestDoMultiwayMergeSortParams_CorruptedTmpFile(t *testing.T) {
+	for _, forecasting := range []bool{false, true} {
+		params := Params{
+			MemoryLimit:                  1000,
+			Arity:                        3,
+			ReserveMemoryForSegmentsInfo: 100,
+			FirstStageMemoryLimit:        10,
+			BufferSize:                   4,
+			Forecasting:                  forecasting,
+			Checksums:                    true,
+			TempDirs:                     []string{t.TempDir()},
+		}
+		s := newSorter(context.Background(), params, uint64Ops(params), util.NewNilSimpleProfiler())
+		defer s.close()
+
+		segments, err := s.runFirstStage(sortio.NewSliceReader(generateRandomArray(100)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// flip a bit in the second block of the file
+		filename := segments[0].filename
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		blockSize := params.BufferSize*sortio.SizeOfValue + sortio.ChecksumSize
+		data[blockSize+3] ^= 1
+		if err := os.WriteFile(filename, data, 0600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err = s.mergeSegmentsTo(segments[:2], sortio.NewSliceWriter[uint64]())
+		var checksumErr *sortio.ChecksumError
+		if !errors.As(err, &checksumErr) {
+			t.Fatalf("expected a checksum error, actual: %v", err)
+		}
+		if checksumErr.File != filename || checksumErr.Offset != int64(blockSize) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestDoMultiwayMergeSortParams_CompressionChecksumsNotEnoughMemory(t *testing.T) {
+	// every reader of a temporary file takes 4 blocks, so the memory is only enough for 1 reader of 10 segments
+	params := Params{
+		MemoryLimit:                  100,
+		Arity:                        -1,
+		ReserveMemoryForSegmentsInfo: 100,
+		FirstStageMemoryLimit:        10,
+		BufferSize:                   4,
+		Compression:                  DeltaCompression,
+		Checksums:                    true,
+		TempDirs:                     []string{t.TempDir()},
+	}
+	err := DoMultiwayMergeSortParams(sortio.NewSliceUint64Reader(generateRandomArray(100)),
+		sortio.NewSliceUint64Writer(), params, util.NewNilSimpleProfiler())
+	if err != ErrNotEnoughMemory {
+		t.Fatalf("expected error: %v, actual: %v", ErrNotEnoughMemory, err)
+	}
+
+	params.Arity = 1
+	err = DoMultiwayMergeSortParams(sortio.NewSliceUint64Reader(generateRandomArray(100)),
+		sortio.NewSliceUint64Writer(), params, util.NewNilSimpleProfiler())
+	if err != ErrValueTooSmall {
+		t.Fatalf("expected error: %v, actual: %v", ErrValueTooSmall, err)
+	}
+}
+
+func TestTmpFileBufferSize(t *testing.T) {
+	testcases := []struct {
+		name     string
+		modify   func(params *Params)
+		expected int
+	}{
+		{"raw", func(params *Params) {}, 4},
+		{"asyncIO", func(params *Params) { params.AsyncIO = true }, 12},
+		{"checksums", func(params *Params) { params.Checksums = true }, 8},
+		{"compression", func(params *Params) { params.Compression = FlateCompression }, 12},
+		{"all", func(params *Params) {
+			params.AsyncIO = true
+			params.Checksums = true
+			params.Compression = DeltaCompression
+		}, 24},
+	}
+	for _, tc := range testcases {
+		params := Params{BufferSize: 4}
+		tc.modify(&params)
+		if actual := TmpFileBufferSize(params); actual != tc.expected {
+			t.Fatalf("%v: expected: %v, actual: %v", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestDefaultArity(t *testing.T) {
+	params := Params{
+		MemoryLimit:                  100,
+		Arity:                        -1,
+		ReserveMemoryForSegmentsInfo: 100,
+		FirstStageMemoryLimit:        10,
+		BufferSize:                   4,
+		Compression:                  DeltaCompression,
+		Checksums:                    true,
+	}
+	testcases := []struct {
+		segmentsCount int
+		arity         int
+		err           error
+	}{
+		{3, 3, nil},
+		{5, 2, nil},
+		// 24 values are left for the readers of 16 values each
+		{6, 0, ErrNotEnoughMemory},
+		{20, 0, ErrNotEnoughMemory},
+	}
+	for _, tc := range testcases {
+		arity, err := DefaultArity(params, tc.segmentsCount)
+		if arity != tc.arity || err != tc.err {
+			t.Fatalf("segments: %v, expected: %v, %v, actual: %v, %v", tc.segmentsCount, tc.arity, tc.err, arity, err)
+		}
+	}
+}
+
 // 500s
 // Warning: you can easily run out of memory while running this benchmark
 func BenchmarkDoMultiwayMergeSort_1G_values(b *testing.B) {
@@ -105,6 +450,39 @@ func BenchmarkDoMultiwayMergeSort_1G_values(b *testing.B) {
 	}
 }
 
+func benchmarkDoMultiwayMergeSortIORatio(b *testing.B, asyncIO bool) {
+	const N = 64 * 1024 * 1024
+	params := DefaultParams(N / 16)
+	params.AsyncIO = asyncIO
+
+	var ioRatio float64 = 0
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		input := sortio.NewSliceUint64Reader(generateRandomArray(N))
+		output := sortio.NewNullUint64Writer()
+		profiler := util.NewSimpleProfiler()
+		b.StartTimer()
+
+		profiler.Start()
+		err := DoMultiwayMergeSortParams(input, output, params, profiler)
+		profiler.Finish()
+		if err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+		ioRatio += profiler.GetMeasuredDurationRatio()
+	}
+	b.ReportMetric(ioRatio/float64(b.N), "io-ratio")
+}
+
+func BenchmarkDoMultiwayMergeSort_64M_values_syncIO(b *testing.B) {
+	benchmarkDoMultiwayMergeSortIORatio(b, false)
+}
+
+func BenchmarkDoMultiwayMergeSort_64M_values_asyncIO(b *testing.B) {
+	benchmarkDoMultiwayMergeSortIORatio(b, true)
+}
+
 func generateRandomArray(count int) []uint64 {
 	result := make([]uint64, count)
 	for i := range result {
@@ -112,3 +490,50 @@ func generateRandomArray(count int) []uint64 {
 	}
 	return result
 }
+
+func testDoMultiwayMergeSortFunc[T any](t *testing.T, codec sortio.Codec[T], less func(a, b T) bool, inputData []T) {
+	params := Params{
+		MemoryLimit:                  1000,
+		Arity:                        3,
+		ReserveMemoryForSegmentsInfo: 100,
+		FirstStageMemoryLimit:        3,
+		BufferSize:                   1,
+	}
+
+	for _, useReplacementSelection := range []bool{false, true} {
+		params.UseReplacementSelection = useReplacementSelection
+
+		input := sortio.NewSliceReader(inputData)
+		output := sortio.NewSliceWriter[T]()
+
+		err := DoMultiwayMergeSortFunc[T](input, output, codec, less, params, util.NewNilSimpleProfiler())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expectedOutput := make([]T, len(inputData))
+		copy(expectedOutput, inputData)
+		sort.SliceStable(expectedOutput, func(i, j int) bool { return less(expectedOutput[i], expectedOutput[j]) })
+
+		if !reflect.DeepEqual(expectedOutput, output.Data()) {
+			t.Errorf("replacement selection: %v, expected output: %v, actual: %v",
+				useReplacementSelection, expectedOutput, output.Data())
+		}
+	}
+}
+
+func TestDoMultiwayMergeSortFunc(t *testing.T) {
+	t.Run("int64", func(t *testing.T) {
+		testDoMultiwayMergeSortFunc(t, sortio.Int64Codec{}, func(a, b int64) bool { return a < b },
+			[]int64{2326, -141, 15, 824, -2, 1882, 344, -152, 85, 5, 123, 123, -1, 268, 1023, 9652})
+	})
+	t.Run("float64", func(t *testing.T) {
+		testDoMultiwayMergeSortFunc(t, sortio.Float64Codec{}, func(a, b float64) bool { return a < b },
+			[]float64{0.5, -3.25, 1e10, 7, 0, -1e-3, 42.42, 8, 1.5, -100})
+	})
+	t.Run("bytes", func(t *testing.T) {
+		testDoMultiwayMergeSortFunc(t, sortio.FixedBytesCodec{Length: 3},
+			func(a, b []byte) bool { return bytes.Compare(a, b) < 0 },
+			[][]byte{[]byte("xyz"), []byte("abc"), []byte("aaa"), []byte("zzz"), []byte("abd"), []byte("b\x00c")})
+	})
+}
@@ -1,7 +1,10 @@
 package extsort
 
 import (
+	"encoding/binary"
+	"fmt"
 	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
 	"log"
 	"math/rand"
 	"reflect"
@@ -61,3 +64,183 @@ func BenchmarkDoMultiwayMerge_4GiB_values(b *testing.B) {
 		DoMultiwayMerge(input, output)
 	}
 }
+
+func TestDoMultiwayMergeFunc(t *testing.T) {
+	var input []sortio.Reader[int64]
+	input = append(input, sortio.NewSliceReader([]int64{1023, 268, 123, 5, -1}))
+	input = append(input, sortio.NewSliceReader([]int64{}))
+	input = append(input, sortio.NewSliceReader([]int64{1024, 700, -700}))
+
+	expectedOutput := []int64{1024, 1023, 700, 268, 123, 5, -1, -700}
+	output := sortio.NewSliceWriter[int64]()
+
+	err := DoMultiwayMergeFunc[int64](input, output, func(a, b int64) bool { return a > b })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(expectedOutput, output.Data()) {
+		t.Fatalf("expected output: %v, actual: %v", expectedOutput, output.Data())
+	}
+}
+
+func TestDoMultiwayMergeLoserTree(t *testing.T) {
+	for _, arity := range []int{0, 1, 2, 3, 5, 8, 13} {
+		var input []sortio.Uint64Reader
+		var expectedOutput []uint64
+		for i := 0; i < arity; i++ {
+			inputPart := make([]uint64, rand.Intn(20))
+			for j := range inputPart {
+				inputPart[j] = uint64(rand.Intn(30))
+			}
+			sort.Slice(inputPart, func(i, j int) bool { return inputPart[i] < inputPart[j] })
+			input = append(input, sortio.NewSliceUint64Reader(inputPart))
+			expectedOutput = append(expectedOutput, inputPart...)
+		}
+		sort.Slice(expectedOutput, func(i, j int) bool { return expectedOutput[i] < expectedOutput[j] })
+		output := sortio.NewSliceUint64Writer()
+
+		err := DoMultiwayMergeLoserTree(input, output)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(expectedOutput) != len(output.Data()) || !reflect.DeepEqual(expectedOutput, output.Data()) {
+			t.Fatalf("arity %v: expected output: %v, actual: %v", arity, expectedOutput, output.Data())
+		}
+	}
+}
+
+func TestDoMultiwayMergeLoserTreeFunc_Stable(t *testing.T) {
+	type pair struct {
+		key, reader int
+	}
+
+	var input []sortio.Reader[pair]
+	var expectedOutput []pair
+	for i := 0; i < 7; i++ {
+		inputPart := make([]pair, rand.Intn(20))
+		for j := range inputPart {
+			inputPart[j] = pair{rand.Intn(5), i}
+		}
+		sort.Slice(inputPart, func(i, j int) bool { return inputPart[i].key > inputPart[j].key })
+		input = append(input, sortio.NewSliceReader(inputPart))
+		expectedOutput = append(expectedOutput, inputPart...)
+	}
+	sort.SliceStable(expectedOutput, func(i, j int) bool { return expectedOutput[i].key > expectedOutput[j].key })
+	output := sortio.NewSliceWriter[pair]()
+
+	err := DoMultiwayMergeLoserTreeFunc(input, output, func(a, b pair) bool { return a.key > b.key })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(expectedOutput, output.Data()) {
+		t.Fatalf("expected output: %v, actual: %v", expectedOutput, output.Data())
+	}
+}
+
+// benchmarkMerge merges 4M random values split between `arity` sorted inputs
+func benchmarkMerge(b *testing.B, merge func(readers []sortio.Uint64Reader, writer sortio.Uint64Writer) error) {
+	const N = 4 * 1024 * 1024
+
+	for arity := 2; arity <= 1024; arity *= 2 {
+		b.Run(fmt.Sprintf("arity_%v", arity), func(b *testing.B) {
+			inputParts := make([][]uint64, arity)
+			for i := range inputParts {
+				inputParts[i] = generateRandomArray(N / arity)
+				sort.Slice(inputParts[i], func(x, y int) bool { return inputParts[i][x] < inputParts[i][y] })
+			}
+
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				input := make([]sortio.Uint64Reader, arity)
+				for i := range input {
+					input[i] = sortio.NewSliceUint64Reader(inputParts[i])
+				}
+
+				merge(input, sortio.NewNullUint64Writer())
+			}
+		})
+	}
+}
+
+// The loser tree does about 35-40% fewer comparisons than the heap for arities from 64 to 1024,
+// but for uint64 values the heap is still 10-30% faster since its comparisons are cheap and it often stops early.
+// For the records with a long common prefix, both are on par and the loser tree wins for the largest arities.
+func BenchmarkDoMultiwayMerge_4M_values_heap(b *testing.B) {
+	benchmarkMerge(b, DoMultiwayMerge)
+}
+
+func BenchmarkDoMultiwayMerge_4M_values_loserTree(b *testing.B) {
+	benchmarkMerge(b, DoMultiwayMergeLoserTree)
+}
+
+// benchmarkMergeFunc is like benchmarkMerge, but the values are compared by a function
+func benchmarkMergeFunc(b *testing.B,
+	merge func(readers []sortio.Reader[uint64], writer sortio.Writer[uint64], less func(a, b uint64) bool) error) {
+
+	benchmarkMerge(b, func(readers []sortio.Uint64Reader, writer sortio.Uint64Writer) error {
+		genericReaders := make([]sortio.Reader[uint64], len(readers))
+		for i, r := range readers {
+			genericReaders[i] = sortio.AsReader(r)
+		}
+		return merge(genericReaders, sortio.AsWriter(writer), LessUnsigned)
+	})
+}
+
+func BenchmarkDoMultiwayMergeFunc_4M_values_heap(b *testing.B) {
+	benchmarkMergeFunc(b, DoMultiwayMergeFunc[uint64])
+}
+
+func BenchmarkDoMultiwayMergeFunc_4M_values_loserTree(b *testing.B) {
+	benchmarkMergeFunc(b, DoMultiwayMergeLoserTreeFunc[uint64])
+}
+
+type nullWriter[T any] struct{}
+
+func (nullWriter[T]) SetProfiler(p *util.SimpleProfiler) {}
+func (nullWriter[T]) Write(x T) error                    { return nil }
+func (nullWriter[T]) Flush() error                       { return nil }
+
+// benchmarkMergeRecords merges 1M 32-byte records with a long common prefix split between `arity` sorted inputs,
+// which makes the comparisons relatively expensive
+func benchmarkMergeRecords(b *testing.B,
+	merge func(readers []sortio.Reader[[]byte], writer sortio.Writer[[]byte], less func(a, b []byte) bool) error) {
+
+	const N = 1024 * 1024
+	const RecordSize = 32
+
+	for arity := 2; arity <= 1024; arity *= 2 {
+		b.Run(fmt.Sprintf("arity_%v", arity), func(b *testing.B) {
+			inputParts := make([][][]byte, arity)
+			for i := range inputParts {
+				inputParts[i] = make([][]byte, N/arity)
+				for j := range inputParts[i] {
+					record := make([]byte, RecordSize)
+					binary.BigEndian.PutUint64(record[RecordSize-8:], rand.Uint64())
+					inputParts[i][j] = record
+				}
+				sort.Slice(inputParts[i], func(x, y int) bool { return LessBytes(inputParts[i][x], inputParts[i][y]) })
+			}
+
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				input := make([]sortio.Reader[[]byte], arity)
+				for i := range input {
+					input[i] = sortio.NewSliceReader(inputParts[i])
+				}
+
+				merge(input, nullWriter[[]byte]{}, LessBytes)
+			}
+		})
+	}
+}
+
+func BenchmarkDoMultiwayMergeFunc_1M_records_heap(b *testing.B) {
+	benchmarkMergeRecords(b, DoMultiwayMergeFunc[[]byte])
+}
+
+func BenchmarkDoMultiwayMergeFunc_1M_records_loserTree(b *testing.B) {
+	benchmarkMergeRecords(b, DoMultiwayMergeLoserTreeFunc[[]byte])
+}
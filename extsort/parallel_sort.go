@@ -0,0 +1,199 @@
+package extsort
+
+import (
+	sortio "github.com/xosmig/extsort/io"
+	"io"
+	"sort"
+)
+
+// DoInitialSortParallel is like DoInitialSort, but it sorts up to `parallelism` chunks concurrently.
+// The memory limit is split between the chunks, so the segments are `parallelism` times shorter.
+// Reading and writing are done by the calling goroutine (the readers, the writers and the profiler
+// are not safe for concurrent use), while the chunks are sorted by separate goroutines.
+// Thus, reading the next chunk and writing the previous ones overlap with sorting.
+func DoInitialSortParallel(
+	r sortio.Uint64Reader,
+	w sortio.Uint64Writer,
+	bufferMemoryLimit, segmentsMemoryLimit, parallelism int) ([]Segment, error) {
+
+	return DoInitialSortParallelAlgorithm(r, w, ComparisonSort, bufferMemoryLimit, segmentsMemoryLimit, parallelism)
+}
+
+// DoInitialSortParallelAlgorithm is like DoInitialSortParallel, but the chunks are sorted by the given algorithm.
+// Each of the concurrently sorted chunks has its own scratch buffer (if the algorithm needs one),
+// which is taken from bufferMemoryLimit.
+func DoInitialSortParallelAlgorithm(
+	r sortio.Uint64Reader,
+	w sortio.Uint64Writer,
+	algorithm InMemorySort,
+	bufferMemoryLimit, segmentsMemoryLimit, parallelism int) ([]Segment, error) {
+
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	chunksMemoryLimit := algorithm.chunkSize(bufferMemoryLimit)
+	chunkSize := chunksMemoryLimit / parallelism
+	if chunkSize < 1 {
+		return nil, ErrNotEnoughMemory
+	}
+
+	// at most `parallelism` chunks are sorted at the same time
+	sorters := make(chan func(chunk []uint64), parallelism)
+	for i := 0; i < parallelism; i++ {
+		sorters <- algorithm.newChunkSorter(chunkSize)
+	}
+	sortChunk := func(chunk []uint64) {
+		sorter := <-sorters
+		sorter(chunk)
+		sorters <- sorter
+	}
+
+	return doInitialSortParallel(sortio.AsReader(r), sortio.AsWriter(w), sortChunk,
+		chunksMemoryLimit, segmentsMemoryLimit, parallelism)
+}
+
+// DoInitialSortParallelFunc is a generic counterpart of DoInitialSortParallel.
+func DoInitialSortParallelFunc[T any](
+	r sortio.Reader[T],
+	w sortio.Writer[T],
+	less func(a, b T) bool,
+	stable bool,
+	bufferMemoryLimit, segmentsMemoryLimit, parallelism int) ([]Segment, error) {
+
+	sortChunk := func(chunk []T) {
+		if stable {
+			sort.SliceStable(chunk, func(i, j int) bool { return less(chunk[i], chunk[j]) })
+		} else {
+			sort.Slice(chunk, func(i, j int) bool { return less(chunk[i], chunk[j]) })
+		}
+	}
+	return doInitialSortParallel(r, w, sortChunk, bufferMemoryLimit, segmentsMemoryLimit, parallelism)
+}
+
+// sortJob is a chunk which is being sorted by a separate goroutine
+type sortJob[T any] struct {
+	buf   []T // the whole buffer, which is returned to the pool after the chunk is written
+	chunk []T
+	done  chan struct{}
+}
+
+func doInitialSortParallel[T any](
+	r sortio.Reader[T],
+	w sortio.Writer[T],
+	sortChunk func([]T),
+	bufferMemoryLimit, segmentsMemoryLimit, parallelism int) ([]Segment, error) {
+
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	chunkSize := bufferMemoryLimit / parallelism
+	if chunkSize < 1 {
+		return nil, ErrNotEnoughMemory
+	}
+
+	var freeBuffers [][]T
+	for i := 0; i < parallelism; i++ {
+		freeBuffers = append(freeBuffers, make([]T, chunkSize))
+	}
+
+	var segments []Segment
+	var segmentBegin uint64 = 0
+	var pending []*sortJob[T] // in the order of the input
+
+	writeOldest := func() error {
+		job := pending[0]
+		pending = pending[1:]
+		<-job.done
+
+		for _, value := range job.chunk {
+			if err := w.Write(value); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		count := uint64(len(job.chunk))
+		segments = append(segments, Segment{segmentBegin, count})
+		segmentBegin += count
+		freeBuffers = append(freeBuffers, job.buf)
+
+		if 2*len(segments) > segmentsMemoryLimit {
+			return ErrNotEnoughMemory
+		}
+		return nil
+	}
+
+	isDone := func(job *sortJob[T]) bool {
+		select {
+		case <-job.done:
+			return true
+		default:
+			return false
+		}
+	}
+
+	for {
+		if len(freeBuffers) == 0 {
+			if err := writeOldest(); err != nil {
+				return nil, err
+			}
+		}
+		buf := freeBuffers[len(freeBuffers)-1]
+		freeBuffers = freeBuffers[:len(freeBuffers)-1]
+
+		valuesRead, err := readChunk(r, buf)
+		if err != nil {
+			return nil, err
+		}
+		if valuesRead == 0 {
+			break
+		}
+
+		job := &sortJob[T]{buf: buf, chunk: buf[:valuesRead], done: make(chan struct{})}
+		go func() {
+			defer CleanupOnPanic()
+			sortChunk(job.chunk)
+			close(job.done)
+		}()
+		pending = append(pending, job)
+
+		// write the chunks, which are already sorted, without waiting for the others
+		for len(pending) > 0 && isDone(pending[0]) {
+			if err := writeOldest(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for len(pending) > 0 {
+		if err := writeOldest(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(segments) == 0 {
+		segments = append(segments, Segment{0, 0})
+	}
+
+	return segments, nil
+}
+
+// readChunk fills buf with values from r and returns the number of values read
+func readChunk[T any](r sortio.Reader[T], buf []T) (int, error) {
+	var valuesRead = 0
+	for valuesRead < len(buf) {
+		value, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		buf[valuesRead] = value
+		valuesRead++
+	}
+	return valuesRead, nil
+}
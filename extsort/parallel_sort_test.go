@@ -0,0 +1,103 @@
+package extsort
+
+import (
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDoInitialSortParallel(t *testing.T) {
+	input := generateRandomArray(10007)
+	const bufferMemoryLimit = 1000
+	const parallelism = 4
+
+	w := sortio.NewSliceUint64Writer()
+	segments, err := DoInitialSortParallel(sortio.NewSliceUint64Reader(input), w, bufferMemoryLimit, 100, parallelism)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(w.Data()) != len(input) {
+		t.Fatalf("expected output length: %v, actual: %v", len(input), len(w.Data()))
+	}
+
+	var begin uint64 = 0
+	for _, segment := range segments {
+		if segment.Begin != begin {
+			t.Fatalf("expected segment begin: %v, actual: %v", begin, segment.Begin)
+		}
+		if segment.Length > bufferMemoryLimit/parallelism {
+			t.Fatalf("the segment is too long: %v", segment.Length)
+		}
+
+		// the segments should contain the sorted chunks of the input in the same order
+		chunk := make([]uint64, segment.Length)
+		copy(chunk, input[begin:begin+segment.Length])
+		sort.Slice(chunk, func(i, j int) bool { return chunk[i] < chunk[j] })
+		if !reflect.DeepEqual(chunk, w.Data()[begin:begin+segment.Length]) {
+			t.Fatalf("invalid segment %v", segment)
+		}
+
+		begin += segment.Length
+	}
+
+	if begin != uint64(len(input)) {
+		t.Fatalf("the segments cover %v values instead of %v", begin, len(input))
+	}
+}
+
+func TestDoMultiwayMergeSortParams_Parallel(t *testing.T) {
+	testcases := []struct {
+		name   string
+		less   func(a, b uint64) bool
+		stable bool
+	}{
+		{"default", nil, false},
+		{"stable", lessHighBits, true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			params := CreateParams(100*1000, 1000, false)
+			params.Parallelism = 8
+			params.Less = tc.less
+			params.Stable = tc.stable
+
+			input := generateValuesWithPositions(1000*1000, 1000)
+			output := sortio.NewSliceUint64Writer()
+			err := DoMultiwayMergeSortParams(sortio.NewSliceUint64Reader(input), output, params,
+				util.NewNilSimpleProfiler())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			less := tc.less
+			if less == nil {
+				less = LessUnsigned
+			}
+			checkStablySorted(t, input, output.Data(), less)
+		})
+	}
+}
+
+func BenchmarkDoInitialSortParallel_200M_values(b *testing.B) {
+	const N = 200 * 1000 * 1000
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		inputData := make([]uint64, N)
+		for i := range inputData {
+			inputData[i] = rand.Uint64()
+		}
+
+		input := sortio.NewSliceUint64Reader(inputData)
+		output := sortio.NewNullUint64Writer()
+		b.StartTimer()
+
+		DoInitialSortParallel(input, output, 100*1000*1000, math.MaxInt32, 8)
+	}
+}
@@ -0,0 +1,156 @@
+package extsort
+
+import (
+	sortio "github.com/xosmig/extsort/io"
+	"sort"
+)
+
+// InMemorySort is the algorithm used by the first stage to sort chunks of uint64 values in memory.
+// The radix sorts are only applicable to the default (ascending) order of values.
+type InMemorySort int
+
+const (
+	// ComparisonSort uses sort.Slice
+	ComparisonSort InMemorySort = iota
+	// LSDRadixSort sorts the values byte by byte starting with the least significant byte.
+	// It needs a scratch buffer of the size of the chunk, so the chunks are 2 times shorter.
+	LSDRadixSort
+	// MSDRadixSort sorts the values in place byte by byte starting with the most significant byte
+	// (American flag sort). It does not need a scratch buffer.
+	MSDRadixSort
+)
+
+const radixBits = 8
+const radixBuckets = 1 << radixBits
+const radixMask = radixBuckets - 1
+
+// msdInsertionSortThreshold is the length of the buckets, which are sorted by insertion sort instead of recursion
+const msdInsertionSortThreshold = 32
+
+// chunkSize returns the maximum number of values in a chunk if the chunk and its scratch buffer
+// must fit into memoryLimit values
+func (a InMemorySort) chunkSize(memoryLimit int) int {
+	if a == LSDRadixSort {
+		return memoryLimit / 2
+	}
+	return memoryLimit
+}
+
+// newChunkSorter returns a function sorting chunks of at most chunkSize values.
+// The function is not safe for concurrent use, since it may reuse a scratch buffer.
+func (a InMemorySort) newChunkSorter(chunkSize int) func(chunk []uint64) {
+	switch a {
+	case LSDRadixSort:
+		scratch := make([]uint64, chunkSize)
+		return func(chunk []uint64) { RadixSortLSD(chunk, scratch) }
+	case MSDRadixSort:
+		return RadixSortMSD
+	default:
+		return func(chunk []uint64) { sort.Slice(chunk, func(i, j int) bool { return chunk[i] < chunk[j] }) }
+	}
+}
+
+// RadixSortLSD sorts the values in ascending order. The scratch buffer must be at least as long as values.
+// The passes for the bytes, which are equal in all the values, are skipped.
+func RadixSortLSD(values, scratch []uint64) {
+	if len(values) < 2 {
+		return
+	}
+
+	var counts [sortio.SizeOfValue][radixBuckets]int
+	for _, value := range values {
+		for digit := 0; digit < sortio.SizeOfValue; digit++ {
+			counts[digit][(value>>(digit*radixBits))&radixMask]++
+		}
+	}
+
+	src, dst := values, scratch[:len(values)]
+	for digit := 0; digit < sortio.SizeOfValue; digit++ {
+		shift := digit * radixBits
+		if counts[digit][(values[0]>>shift)&radixMask] == len(values) {
+			// all the values have the same byte
+			continue
+		}
+
+		var offsets [radixBuckets]int
+		offset := 0
+		for bucket, count := range counts[digit] {
+			offsets[bucket] = offset
+			offset += count
+		}
+
+		for _, value := range src {
+			bucket := (value >> shift) & radixMask
+			dst[offsets[bucket]] = value
+			offsets[bucket]++
+		}
+		src, dst = dst, src
+	}
+
+	if &src[0] != &values[0] {
+		copy(values, src)
+	}
+}
+
+// RadixSortMSD sorts the values in ascending order in place.
+func RadixSortMSD(values []uint64) {
+	radixSortMSD(values, (sortio.SizeOfValue-1)*radixBits)
+}
+
+func radixSortMSD(values []uint64, shift int) {
+	if len(values) < msdInsertionSortThreshold {
+		insertionSortUint64(values)
+		return
+	}
+
+	var counts [radixBuckets]int
+	for _, value := range values {
+		counts[(value>>shift)&radixMask]++
+	}
+
+	var heads, tails [radixBuckets]int
+	offset := 0
+	for bucket, count := range counts {
+		heads[bucket] = offset
+		offset += count
+		tails[bucket] = offset
+	}
+
+	// move every value to its bucket following the cycles of the permutation
+	for bucket := range counts {
+		for heads[bucket] < tails[bucket] {
+			value := values[heads[bucket]]
+			target := int((value >> shift) & radixMask)
+			for target != bucket {
+				values[heads[target]], value = value, values[heads[target]]
+				heads[target]++
+				target = int((value >> shift) & radixMask)
+			}
+			values[heads[bucket]] = value
+			heads[bucket]++
+		}
+	}
+
+	if shift == 0 {
+		return
+	}
+
+	begin := 0
+	for _, count := range counts {
+		if count > 1 {
+			radixSortMSD(values[begin:begin+count], shift-radixBits)
+		}
+		begin += count
+	}
+}
+
+func insertionSortUint64(values []uint64) {
+	for i := 1; i < len(values); i++ {
+		value := values[i]
+		j := i
+		for ; j > 0 && values[j-1] > value; j-- {
+			values[j] = values[j-1]
+		}
+		values[j] = value
+	}
+}
@@ -0,0 +1,218 @@
+package extsort
+
+import (
+	"bytes"
+	"context"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"io"
+	"sort"
+)
+
+// Variable-length records (e.g. lines of a text file) are sorted by the same algorithm as fixed-size values.
+// The differences are:
+//   - all the memory-related Params (MemoryLimit, BufferSize, FirstStageMemoryLimit) are expressed in bytes;
+//   - the temporary files use the length-prefixed format of sortio.RecordWriter;
+//   - Segment.Begin is expressed in bytes rather than in values, Segment.Length is still the number of records.
+
+// recordOverhead is the approximate amount of memory used to keep a record in memory in addition to its bytes
+// (the slice header in the array of records).
+const recordOverhead = 24
+
+func LessBytes(a, b []byte) bool {
+	return bytes.Compare(a, b) < 0
+}
+
+// memoryAccountant keeps track of the number of bytes occupied by variable-length records.
+type memoryAccountant struct {
+	limit int
+	used  int
+}
+
+func newMemoryAccountant(limit int) *memoryAccountant {
+	return &memoryAccountant{limit: limit}
+}
+
+// TryReserve reserves memory for the record. It returns false if the record does not fit into the limit.
+func (a *memoryAccountant) TryReserve(record []byte) bool {
+	cost := len(record) + recordOverhead
+	if a.used+cost > a.limit {
+		return false
+	}
+	a.used += cost
+	return true
+}
+
+func (a *memoryAccountant) Reset() {
+	a.used = 0
+}
+
+// DoInitialSortRecords reads variable-length records, sorts chunks of at most bufferMemoryLimit bytes in memory
+// and writes them to w, which is expected to use the length-prefixed format of sortio.RecordWriter.
+// A single record larger than bufferMemoryLimit forms its own segment.
+func DoInitialSortRecords(
+	r sortio.Reader[[]byte],
+	w sortio.Writer[[]byte],
+	less func(a, b []byte) bool,
+	bufferMemoryLimit, segmentsMemoryLimit int) ([]Segment, error) {
+
+	return doInitialSortRecords(r, w, less, false, false, bufferMemoryLimit, segmentsMemoryLimit)
+}
+
+func doInitialSortRecords(
+	r sortio.Reader[[]byte],
+	w sortio.Writer[[]byte],
+	less func(a, b []byte) bool,
+	stable bool,
+	unique bool,
+	bufferMemoryLimit, segmentsMemoryLimit int) ([]Segment, error) {
+
+	accountant := newMemoryAccountant(bufferMemoryLimit)
+	var records [][]byte
+	var pending []byte
+	hasPending := false
+
+	var segments []Segment
+	var segmentBegin uint64 = 0
+	eof := false
+	for !eof {
+		records = records[:0]
+		accountant.Reset()
+
+		// a record larger than the limit forms its own segment, so that the next records are not added to it
+		oversized := false
+		if hasPending {
+			oversized = !accountant.TryReserve(pending)
+			records = append(records, pending)
+			hasPending = false
+		}
+
+		for !oversized {
+			record, err := r.Read()
+			if err == io.EOF {
+				eof = true
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if !accountant.TryReserve(record) {
+				if len(records) > 0 {
+					pending, hasPending = record, true
+					break
+				}
+				oversized = true
+			}
+			records = append(records, record)
+		}
+
+		if len(records) == 0 {
+			break
+		}
+
+		if stable {
+			sort.SliceStable(records, func(i, j int) bool { return less(records[i], records[j]) })
+		} else {
+			sort.Slice(records, func(i, j int) bool { return less(records[i], records[j]) })
+		}
+		if unique {
+			// the segment offsets are expressed in bytes, so the records are dropped before they are written
+			records = dropEqual(records, less)
+		}
+
+		var segmentBytes uint64 = 0
+		for _, record := range records {
+			err := w.Write(record)
+			if err != nil {
+				return nil, err
+			}
+			segmentBytes += uint64(sortio.RecordEncodedSize(record))
+		}
+
+		segments = append(segments, Segment{segmentBegin, uint64(len(records))})
+		segmentBegin += segmentBytes
+
+		if 2*len(segments) > segmentsMemoryLimit {
+			return nil, ErrNotEnoughMemory
+		}
+	}
+
+	if len(segments) == 0 {
+		segments = append(segments, Segment{0, 0})
+	}
+
+	err := w.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return segments, nil
+}
+
+// DoMultiwayMergeSortRecords sorts variable-length records using at most params.MemoryLimit bytes of memory
+// for the records and the buffers. Params are expressed in bytes.
+func DoMultiwayMergeSortRecords(
+	r sortio.Reader[[]byte],
+	w sortio.Writer[[]byte],
+	less func(a, b []byte) bool,
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	return DoMultiwayMergeSortRecordsContext(context.Background(), r, w, less, params, profiler)
+}
+
+// DoMultiwayMergeSortRecordsContext is like DoMultiwayMergeSortRecords, but it can be cancelled
+// (see DoMultiwayMergeSortParamsContext).
+func DoMultiwayMergeSortRecordsContext(
+	ctx context.Context,
+	r sortio.Reader[[]byte],
+	w sortio.Writer[[]byte],
+	less func(a, b []byte) bool,
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	if params.UseReplacementSelection || params.InMemorySort != ComparisonSort {
+		return ErrNotSupported
+	}
+
+	s := newSorter(ctx, params, recordsOps(less), profiler)
+	defer s.close()
+	return s.doSort(r, w)
+}
+
+// ResumeMultiwayMergeSortRecordsContext continues a sort of variable-length records from the checkpoint
+// (see ResumeMultiwayMergeSortParamsContext).
+func ResumeMultiwayMergeSortRecordsContext(
+	ctx context.Context,
+	checkpoint string,
+	w sortio.Writer[[]byte],
+	less func(a, b []byte) bool,
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	params.Checkpoint = checkpoint
+	s := newSorter(ctx, params, recordsOps(less), profiler)
+	defer s.close()
+	return s.resume(w)
+}
+
+func recordsOps(less func(a, b []byte) bool) sortOps[[]byte] {
+	return sortOps[[]byte]{
+		valueSize: 1,
+		firstStage: func(r sortio.Reader[[]byte], w sortio.Writer[[]byte], params Params) ([]Segment, error) {
+			return doInitialSortRecords(r, w, less, params.Stable, params.Unique,
+				params.FirstStageMemoryLimit, params.ReserveMemoryForSegmentsInfo)
+		},
+		merge: func(readers []sortio.Reader[[]byte], w sortio.Writer[[]byte], params Params) error {
+			return doMultiwayMergeParamsFunc(readers, w, less, params)
+		},
+		newReader: func(r io.Reader, count int, buf []byte, length uint64) sortio.Reader[[]byte] {
+			return sortio.NewBoundedReader[[]byte](sortio.NewRecordReaderSize(r, count), length)
+		},
+		newWriter: func(w sortio.WriteSyncer, count int, buf []byte) sortio.Writer[[]byte] {
+			return sortio.NewRecordWriterSize(w, count)
+		},
+		less: less,
+	}
+}
@@ -0,0 +1,166 @@
+package extsort
+
+import (
+	"fmt"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func generateRandomRecords(count int) [][]byte {
+	result := make([][]byte, count)
+	for i := range result {
+		result[i] = []byte(fmt.Sprintf("%x", rand.Uint64()>>uint(rand.Intn(64))))
+	}
+	return result
+}
+
+func TestDoMultiwayMergeSortRecords(t *testing.T) {
+	testcases := []struct {
+		inputData [][]byte
+		params    Params
+		name      string
+	}{
+		{
+			inputData: [][]byte{[]byte("banana"), []byte(""), []byte("apple"), []byte("cherry"), []byte("a"),
+				[]byte("apple"), []byte("a very long line which does not fit into the memory limit"), []byte("b")},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        2 * (recordOverhead + 6),
+				BufferSize:                   16,
+			},
+			name: "small",
+		},
+		{
+			inputData: [][]byte{[]byte("banana"), []byte(""), []byte("apple"), []byte("cherry"), []byte("a"),
+				[]byte("apple"), []byte("a very long line which does not fit into the memory limit"), []byte("b")},
+			params: Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 100,
+				FirstStageMemoryLimit:        2 * (recordOverhead + 6),
+				BufferSize:                   16,
+				Checksums:                    true,
+			},
+			name: "small_checksums",
+		},
+		{
+			inputData: [][]byte{},
+			params:    CreateParams(1024*1024, 4096, false),
+			name:      "empty",
+		},
+		{
+			inputData: generateRandomRecords(100 * 1000),
+			params:    CreateParams(1024*1024, 4096, false),
+			name:      "100K_randomRecords",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := sortio.NewSliceReader(tc.inputData)
+			output := sortio.NewSliceWriter[[]byte]()
+
+			err := DoMultiwayMergeSortRecords(input, output, LessBytes, tc.params, util.NewNilSimpleProfiler())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			expectedOutput := make([][]byte, len(tc.inputData))
+			copy(expectedOutput, tc.inputData)
+			sort.Slice(expectedOutput, func(i, j int) bool { return LessBytes(expectedOutput[i], expectedOutput[j]) })
+
+			if len(expectedOutput) != len(output.Data()) {
+				t.Fatalf("expected output length: %v, actual: %v", len(expectedOutput), len(output.Data()))
+			}
+
+			for i := range expectedOutput {
+				if string(expectedOutput[i]) != string(output.Data()[i]) {
+					t.Fatalf("expected %q at position %v, actual: %q", expectedOutput[i], i, output.Data()[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDoMultiwayMergeSortRecords_CompressionNotSupported(t *testing.T) {
+	params := CreateParams(1024*1024, 4096, false)
+	params.Compression = DeltaCompression
+
+	err := DoMultiwayMergeSortRecords(sortio.NewSliceReader(generateRandomRecords(10)), sortio.NewSliceWriter[[]byte](),
+		LessBytes, params, util.NewNilSimpleProfiler())
+	if err != ErrNotSupported {
+		t.Fatalf("expected error: %v, actual: %v", ErrNotSupported, err)
+	}
+}
+
+func TestDoInitialSortRecords(t *testing.T) {
+	input := [][]byte{[]byte("ccc"), []byte("bbb"), []byte("aaa"), []byte("dd")}
+	// two records of length 3 fit into the buffer
+	const bufferMemoryLimit = 2 * (recordOverhead + 3)
+
+	w := sortio.NewSliceWriter[[]byte]()
+	segments, err := DoInitialSortRecords(sortio.NewSliceReader(input), w, LessBytes, bufferMemoryLimit, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedOutput := [][]byte{[]byte("bbb"), []byte("ccc"), []byte("aaa"), []byte("dd")}
+	if !reflect.DeepEqual(expectedOutput, w.Data()) {
+		t.Errorf("expected: %q, actual: %q", expectedOutput, w.Data())
+	}
+
+	// each record takes 1 byte for the length and the bytes of the record itself
+	expectedSegments := []Segment{{0, 2}, {8, 2}}
+	if !reflect.DeepEqual(expectedSegments, segments) {
+		t.Errorf("expected segments: %v, actual: %v", expectedSegments, segments)
+	}
+}
+
+func TestDoInitialSortRecords_LargeRecord(t *testing.T) {
+	long := []byte(strings.Repeat("z", 36))
+	// two records of length 1 fit into the buffer, the long record does not fit even alone
+	const bufferMemoryLimit = 2 * (recordOverhead + 1)
+
+	testcases := []struct {
+		name             string
+		input            [][]byte
+		expectedOutput   [][]byte
+		expectedSegments []Segment
+	}{
+		{
+			"first",
+			[][]byte{long, []byte("b"), []byte("a"), []byte("c")},
+			[][]byte{long, []byte("a"), []byte("b"), []byte("c")},
+			[]Segment{{0, 1}, {37, 2}, {41, 1}},
+		},
+		{
+			"pending",
+			[][]byte{[]byte("b"), long, []byte("c"), []byte("a")},
+			[][]byte{[]byte("b"), long, []byte("a"), []byte("c")},
+			[]Segment{{0, 1}, {2, 1}, {39, 2}},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := sortio.NewSliceWriter[[]byte]()
+			segments, err := DoInitialSortRecords(sortio.NewSliceReader(tc.input), w, LessBytes, bufferMemoryLimit, 100)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tc.expectedOutput, w.Data()) {
+				t.Errorf("expected: %q, actual: %q", tc.expectedOutput, w.Data())
+			}
+			if !reflect.DeepEqual(tc.expectedSegments, segments) {
+				t.Errorf("expected segments: %v, actual: %v", tc.expectedSegments, segments)
+			}
+		})
+	}
+}
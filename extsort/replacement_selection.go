@@ -36,6 +36,10 @@ func DoReplacementSelection(
 			if err != nil {
 				return err
 			}
+			// start the next segment from a new block of a compressed file
+			if err := w.Flush(); err != nil {
+				return err
+			}
 
 			lastWrittenValue = 0
 			segmentBegin = elementsWritten
@@ -106,3 +110,99 @@ func DoReplacementSelection(
 
 	return segments, nil
 }
+
+// DoReplacementSelectionFunc is a generic counterpart of DoReplacementSelection.
+// Values are ordered by the less function.
+func DoReplacementSelectionFunc[T any](
+	r sortio.Reader[T],
+	w sortio.Writer[T],
+	less func(a, b T) bool,
+	heapMemoryLimit, segmentsMemoryLimit int) ([]Segment, error) {
+
+	var currentHeap, nextHeap = util.NewSharedBufHeapFunc(heapMemoryLimit, less)
+
+	var lastWrittenValue T
+	var elementsWritten uint64 = 0
+	var segments []Segment
+	var segmentBegin uint64 = 0
+
+	addSegment := func(segment Segment) error {
+		segments = append(segments, segment)
+		if 2*len(segments) > segmentsMemoryLimit {
+			return ErrNotEnoughMemory
+		}
+		return nil
+	}
+
+	flushOneElement := func() error {
+		if currentHeap.Len() == 0 {
+			err := addSegment(Segment{segmentBegin, elementsWritten - segmentBegin})
+			if err != nil {
+				return err
+			}
+			// start the next segment from a new block of a compressed file
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			segmentBegin = elementsWritten
+			currentHeap, nextHeap = nextHeap, currentHeap
+			currentHeap.HInit()
+		}
+
+		lastWrittenValue = currentHeap.HPop()
+		if err := w.Write(lastWrittenValue); err != nil {
+			return err
+		}
+		elementsWritten++
+
+		return nil
+	}
+
+	for currentHeap.Cap() > 0 {
+		value, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		currentHeap.ArrayPush(value)
+	}
+	currentHeap.HInit()
+
+	var value T
+	var err error
+	for sortio.ReadTo(r, &value, &err) {
+		if err = flushOneElement(); err != nil {
+			return nil, err
+		}
+
+		if !less(value, lastWrittenValue) {
+			currentHeap.HPush(value)
+		} else {
+			nextHeap.ArrayPush(value)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for currentHeap.Len() > 0 || nextHeap.Len() > 0 {
+		if err = flushOneElement(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = addSegment(Segment{segmentBegin, elementsWritten - segmentBegin}); err != nil {
+		return nil, err
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return segments, nil
+}
@@ -2,13 +2,13 @@ package extsort
 
 import (
 	"container/heap"
-	sortio "github.com/xosmig/extsort/io"
 	"os"
 )
 
 type sortSegment struct {
-	skipValues, count uint64
-	filename          string
+	offset   int64 // in bytes, the compressed and checksummed files are seekable at the beginning of every segment
+	count    uint64
+	filename string
 }
 
 func (s *sortSegment) Open() (*os.File, error) {
@@ -17,7 +17,7 @@ func (s *sortSegment) Open() (*os.File, error) {
 		return nil, err
 	}
 
-	_, err = f.Seek(int64(s.skipValues*sortio.SizeOfValue), os.SEEK_SET)
+	_, err = f.Seek(s.offset, os.SEEK_SET)
 	if err != nil {
 		f.Close()
 		return nil, err
@@ -0,0 +1,91 @@
+package extsort
+
+import (
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+)
+
+// sequenced is a value along with a sequence number, which is used to break ties between equal values
+type sequenced[T any] struct {
+	v   T
+	seq uint64
+}
+
+func sequencedLess[T any](less func(a, b T) bool) func(a, b sequenced[T]) bool {
+	return func(a, b sequenced[T]) bool {
+		if less(a.v, b.v) {
+			return true
+		}
+		if less(b.v, a.v) {
+			return false
+		}
+		return a.seq < b.seq
+	}
+}
+
+// sequencingReader assigns sequence numbers starting with next and increasing by step to the values of impl
+type sequencingReader[T any] struct {
+	impl sortio.Reader[T]
+	next uint64
+	step uint64
+}
+
+func (r *sequencingReader[T]) SetProfiler(p *util.SimpleProfiler) {
+	r.impl.SetProfiler(p)
+}
+
+func (r *sequencingReader[T]) Read() (sequenced[T], error) {
+	value, err := r.impl.Read()
+	if err != nil {
+		return sequenced[T]{}, err
+	}
+
+	result := sequenced[T]{value, r.next}
+	r.next += r.step
+	return result, nil
+}
+
+// unsequencingWriter drops the sequence numbers and writes the values to impl
+type unsequencingWriter[T any] struct {
+	impl sortio.Writer[T]
+}
+
+func (w unsequencingWriter[T]) SetProfiler(p *util.SimpleProfiler) {
+	w.impl.SetProfiler(p)
+}
+
+func (w unsequencingWriter[T]) Write(x sequenced[T]) error {
+	return w.impl.Write(x.v)
+}
+
+func (w unsequencingWriter[T]) Flush() error {
+	return w.impl.Flush()
+}
+
+// DoMultiwayMergeStableFunc is like DoMultiwayMergeFunc, but ties are broken by the index of the reader:
+// among equal values, the values from the readers with smaller indices are written first.
+func DoMultiwayMergeStableFunc[T any](readers []sortio.Reader[T], writer sortio.Writer[T], less func(a, b T) bool) error {
+	sequencedReaders := make([]sortio.Reader[sequenced[T]], len(readers))
+	for idx, r := range readers {
+		sequencedReaders[idx] = &sequencingReader[T]{impl: r, next: uint64(idx), step: 0}
+	}
+
+	return DoMultiwayMergeFunc(sequencedReaders, unsequencingWriter[T]{writer}, sequencedLess(less))
+}
+
+// DoReplacementSelectionStableFunc is like DoReplacementSelectionFunc, but it preserves the input order
+// of equal values within the runs. Since the values with equal keys never go to a later run
+// than the values read after them, the first stage as a whole is stable.
+// The sequence numbers are stored along with the values, so heapMemoryLimit is expressed in these pairs.
+func DoReplacementSelectionStableFunc[T any](
+	r sortio.Reader[T],
+	w sortio.Writer[T],
+	less func(a, b T) bool,
+	heapMemoryLimit, segmentsMemoryLimit int) ([]Segment, error) {
+
+	return DoReplacementSelectionFunc[sequenced[T]](
+		&sequencingReader[T]{impl: r, next: 0, step: 1},
+		unsequencingWriter[T]{w},
+		sequencedLess(less),
+		heapMemoryLimit, segmentsMemoryLimit)
+}
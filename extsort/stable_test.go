@@ -0,0 +1,99 @@
+package extsort
+
+import (
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"math/rand"
+	"testing"
+)
+
+// the keys are stored in the high 32 bits and the positions in the input are stored in the low 32 bits
+func lessHighBits(a, b uint64) bool {
+	return a>>32 < b>>32
+}
+
+func generateValuesWithPositions(count int, keysCount uint64) []uint64 {
+	result := make([]uint64, count)
+	for i := range result {
+		result[i] = (rand.Uint64()%keysCount)<<32 | uint64(i)
+	}
+	return result
+}
+
+func checkStablySorted(t *testing.T, input, output []uint64, less func(a, b uint64) bool) {
+	if len(input) != len(output) {
+		t.Fatalf("expected output length: %v, actual: %v", len(input), len(output))
+	}
+
+	for i := 1; i < len(output); i++ {
+		if less(output[i], output[i-1]) {
+			t.Fatalf("the output is not sorted at position %v", i)
+		}
+		if !less(output[i-1], output[i]) && uint32(output[i-1]) > uint32(output[i]) {
+			t.Fatalf("the order of equal values is not preserved at position %v: %x, %x", i, output[i-1], output[i])
+		}
+	}
+}
+
+func TestDoMultiwayMergeSortParams_Stable(t *testing.T) {
+	testcases := []struct {
+		name                    string
+		useReplacementSelection bool
+		less                    func(a, b uint64) bool
+		useLoserTree            bool
+	}{
+		{"initialSort", false, lessHighBits, false},
+		{"replacementSelection", true, lessHighBits, false},
+		{"initialSort_descending", false, Reverse(lessHighBits), false},
+		{"replacementSelection_descending", true, Reverse(lessHighBits), false},
+		{"initialSort_loserTree", false, lessHighBits, true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			// a lot of small runs and a small arity to force several merge passes
+			params := Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 10000,
+				FirstStageMemoryLimit:        7,
+				BufferSize:                   2,
+				UseReplacementSelection:      tc.useReplacementSelection,
+				Less:                         tc.less,
+				Stable:                       true,
+				UseLoserTree:                 tc.useLoserTree,
+			}
+
+			input := generateValuesWithPositions(1000, 10)
+			output := sortio.NewSliceUint64Writer()
+			err := DoMultiwayMergeSortParams(sortio.NewSliceUint64Reader(input), output, params,
+				util.NewNilSimpleProfiler())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			checkStablySorted(t, input, output.Data(), tc.less)
+		})
+	}
+}
+
+func TestDoMultiwayMergeStableFunc(t *testing.T) {
+	readers := []sortio.Reader[uint64]{
+		sortio.NewSliceReader([]uint64{1<<32 | 0, 2<<32 | 1, 2<<32 | 2}),
+		sortio.NewSliceReader([]uint64{1<<32 | 3, 2<<32 | 4}),
+		sortio.NewSliceReader([]uint64{0<<32 | 5, 2<<32 | 6}),
+	}
+
+	output := sortio.NewSliceWriter[uint64]()
+	err := DoMultiwayMergeStableFunc(readers, output, lessHighBits)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedPositions := []uint32{5, 0, 3, 1, 2, 4, 6}
+	for i, value := range output.Data() {
+		if uint32(value) != expectedPositions[i] {
+			t.Fatalf("expected positions: %v, actual output: %x", expectedPositions, output.Data())
+		}
+	}
+}
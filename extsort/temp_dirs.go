@@ -0,0 +1,205 @@
+package extsort
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TempDirPolicy defines how the temporary files are distributed across Params.TempDirs.
+type TempDirPolicy int
+
+const (
+	// RoundRobin uses the directories in turn, so that the runs merged together are read from several disks.
+	RoundRobin TempDirPolicy = iota
+	// MostFreeSpace puts every file to the directory with the most free space at the moment.
+	// It falls back to RoundRobin if the free space cannot be determined.
+	MostFreeSpace
+)
+
+// Each sorter holds an exclusive lock on a lock file "extsort_<random>.lock" containing its PID
+// in every directory where it creates temporary files. The temporary files are named after the lock file:
+// "extsort_<random>_tmp_<random>". If a process dies without removing its temporary files,
+// the lock is released by the operating system, and the next sorter using the directory removes the files.
+const lockFilePattern = "extsort_*.lock"
+const lockFileSuffix = ".lock"
+const tmpFileInfix = "_tmp_"
+
+// The temporary files kept for resuming a sort (see Params.Checkpoint) are renamed to "extsort_<random>_run_<random>",
+// so that they are not swept after the process dies.
+const runFileInfix = "_run_"
+
+// tempDirs chooses the directories for the temporary files of a sorter
+type tempDirs struct {
+	dirs   []string
+	policy TempDirPolicy
+	next   int
+	locks  map[string]*dirLock
+}
+
+// newTempDirs uses os.TempDir() (which respects TMPDIR) if no directories are given
+func newTempDirs(dirs []string, policy TempDirPolicy) *tempDirs {
+	if len(dirs) == 0 {
+		dirs = []string{os.TempDir()}
+	}
+	return &tempDirs{dirs: dirs, policy: policy, locks: make(map[string]*dirLock)}
+}
+
+func (t *tempDirs) Next() string {
+	if t.policy == MostFreeSpace && len(t.dirs) > 1 {
+		if dir, ok := t.mostFreeSpace(); ok {
+			return dir
+		}
+	}
+
+	dir := t.dirs[t.next]
+	t.next = (t.next + 1) % len(t.dirs)
+	return dir
+}
+
+func (t *tempDirs) mostFreeSpace() (string, bool) {
+	best := ""
+	var bestSpace uint64 = 0
+	for _, dir := range t.dirs {
+		space, err := freeSpace(dir)
+		if err != nil {
+			return "", false
+		}
+		if best == "" || space > bestSpace {
+			best, bestSpace = dir, space
+		}
+	}
+	return best, true
+}
+
+// CreateTemp creates a new temporary file in the next directory.
+// The first use of a directory removes the stale temporary files left there by dead processes.
+func (t *tempDirs) CreateTemp() (*os.File, error) {
+	dir := t.Next()
+
+	lock, ok := t.locks[dir]
+	if !ok {
+		sweepStaleTmpFiles(dir)
+
+		var err error
+		lock, err = newDirLock(dir)
+		if err != nil {
+			return nil, err
+		}
+		t.locks[dir] = lock
+	}
+
+	f, err := os.CreateTemp(dir, lock.prefix+tmpFileInfix+"*")
+	if err != nil {
+		return nil, err
+	}
+	registry.Add(f.Name())
+	return f, nil
+}
+
+// Remove removes a temporary file created by CreateTemp
+func (t *tempDirs) Remove(filename string) {
+	registry.Remove(filename)
+}
+
+// Persist renames a temporary file created by CreateTemp, so that it is neither swept nor removed
+// on signals and panics. It returns the new absolute name of the file, so that it can be found from another directory.
+func (t *tempDirs) Persist(filename string) (string, error) {
+	dir, base := filepath.Split(filename)
+	persisted, err := filepath.Abs(filepath.Join(dir, strings.Replace(base, tmpFileInfix, runFileInfix, 1)))
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(filename, persisted); err != nil {
+		return "", err
+	}
+	registry.Forget(filename)
+	return persisted, nil
+}
+
+// Close releases and removes the lock files. The temporary files must be removed before.
+func (t *tempDirs) Close() {
+	for _, lock := range t.locks {
+		lock.Close()
+	}
+	t.locks = make(map[string]*dirLock)
+}
+
+// dirLock is the lock file of a sorter in a directory
+type dirLock struct {
+	f      *os.File
+	prefix string // the base name of the lock file without the suffix
+}
+
+func newDirLock(dir string) (*dirLock, error) {
+	for {
+		f, err := os.CreateTemp(dir, lockFilePattern)
+		if err != nil {
+			return nil, err
+		}
+		registry.Add(f.Name())
+
+		locked, err := tryLockFile(f)
+		if err == ErrNotSupported {
+			// the temporary files are not protected from the sweep, which is not supported as well
+			locked, err = true, nil
+		}
+		if err == nil && locked && isSameFile(f) {
+			if _, err = f.WriteString(strconv.Itoa(os.Getpid()) + "\n"); err == nil {
+				return &dirLock{f: f, prefix: strings.TrimSuffix(filepath.Base(f.Name()), lockFileSuffix)}, nil
+			}
+		}
+
+		f.Close()
+		if err != nil {
+			registry.Remove(f.Name())
+			return nil, err
+		}
+		// another process has swept the lock file before it was locked, try again
+		registry.Remove(f.Name())
+	}
+}
+
+// isSameFile checks that the file is still present under its name
+func isSameFile(f *os.File) bool {
+	opened, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(f.Name())
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, current)
+}
+
+func (l *dirLock) Close() {
+	// remove the file before closing it, so that it is never swept while there still may be temporary files
+	registry.Remove(l.f.Name())
+	l.f.Close()
+}
+
+// sweepStaleTmpFiles removes the temporary files of the sorters, which hold no locks on their lock files.
+// Errors are ignored since the sweep is a best-effort operation.
+func sweepStaleTmpFiles(dir string) {
+	lockFiles, _ := filepath.Glob(filepath.Join(dir, lockFilePattern))
+	for _, lockFile := range lockFiles {
+		f, err := os.OpenFile(lockFile, os.O_RDWR, 0)
+		if err != nil {
+			continue
+		}
+
+		locked, err := tryLockFile(f)
+		if err == nil && locked {
+			// the owner is dead
+			prefix := strings.TrimSuffix(lockFile, lockFileSuffix)
+			tmpFiles, _ := filepath.Glob(prefix + tmpFileInfix + "*")
+			for _, tmpFile := range tmpFiles {
+				os.Remove(tmpFile)
+			}
+			os.Remove(lockFile)
+		}
+		f.Close()
+	}
+}
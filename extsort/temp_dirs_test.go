@@ -0,0 +1,82 @@
+package extsort
+
+import (
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTempDirs_RoundRobin(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+	tmpDirs := newTempDirs(dirs, RoundRobin)
+
+	for i := 0; i < 7; i++ {
+		f, err := tmpDirs.CreateTemp()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f.Close()
+
+		if filepath.Dir(f.Name()) != dirs[i%len(dirs)] {
+			t.Fatalf("file %v is expected to be in %v", f.Name(), dirs[i%len(dirs)])
+		}
+	}
+}
+
+func TestTempDirs_MostFreeSpace(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	tmpDirs := newTempDirs(dirs, MostFreeSpace)
+
+	dir := tmpDirs.Next()
+	if dir != dirs[0] && dir != dirs[1] {
+		t.Fatalf("unexpected directory: %v", dir)
+	}
+}
+
+func TestTempDirs_Default(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	if dir := newTempDirs(nil, RoundRobin).Next(); dir != tmpDir {
+		t.Fatalf("expected directory: %v, actual: %v", tmpDir, dir)
+	}
+}
+
+func TestDoMultiwayMergeSortParams_TempDirs(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	params := Params{
+		MemoryLimit:                  1000,
+		Arity:                        3,
+		ReserveMemoryForSegmentsInfo: 10000,
+		FirstStageMemoryLimit:        10,
+		BufferSize:                   2,
+		TempDirs:                     dirs,
+	}
+
+	input := generateRandomArray(1000)
+	output := sortio.NewSliceUint64Writer()
+	err := DoMultiwayMergeSortParams(sortio.NewSliceUint64Reader(input), output, params, util.NewNilSimpleProfiler())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sort.Slice(input, func(i, j int) bool { return input[i] < input[j] })
+	if !reflect.DeepEqual(input, output.Data()) {
+		t.Fatalf("the actual output differs from the expected output")
+	}
+
+	// the temporary files should be removed
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(entries) != 0 {
+			t.Fatalf("the temporary files are not removed from %v", dir)
+		}
+	}
+}
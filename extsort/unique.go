@@ -0,0 +1,188 @@
+package extsort
+
+import (
+	"context"
+	"encoding/binary"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+)
+
+// uniqueWriter drops the values equal to the previous value (see Params.Unique).
+// Only the adjacent values are compared, so the values must be sorted between the calls of Flush.
+// Flush ends a segment of the first stage, so the next value is not compared with the previous one.
+// If combine is set, the equal values are combined by it instead of being dropped, so every value is only written
+// when the next distinct value or Flush comes.
+type uniqueWriter[T any] struct {
+	impl       sortio.Writer[T]
+	less       func(a, b T) bool
+	combine    func(a, b T) T
+	pending    T
+	hasPending bool
+	// read and written are the numbers of values before and after the deduplication
+	read    uint64
+	written uint64
+	// flushPoints maps the number of values read to the number of values written at every Flush
+	flushPoints map[uint64]uint64
+}
+
+func newUniqueWriter[T any](w sortio.Writer[T], less func(a, b T) bool, combine func(a, b T) T) *uniqueWriter[T] {
+	return &uniqueWriter[T]{
+		impl:        w,
+		less:        less,
+		combine:     combine,
+		flushPoints: map[uint64]uint64{0: 0},
+	}
+}
+
+func (w *uniqueWriter[T]) SetProfiler(p *util.SimpleProfiler) {
+	w.impl.SetProfiler(p)
+}
+
+func (w *uniqueWriter[T]) Write(x T) error {
+	w.read++
+	// the values are sorted, so x is equal to the pending value unless it is greater
+	if w.hasPending && !w.less(w.pending, x) {
+		if w.combine != nil {
+			w.pending = w.combine(w.pending, x)
+		}
+		return nil
+	}
+
+	err := w.writePending()
+	w.pending, w.hasPending = x, true
+	return err
+}
+
+func (w *uniqueWriter[T]) writePending() error {
+	if !w.hasPending {
+		return nil
+	}
+	w.hasPending = false
+	w.written++
+	return w.impl.Write(w.pending)
+}
+
+func (w *uniqueWriter[T]) Flush() error {
+	if err := w.writePending(); err != nil {
+		return err
+	}
+	w.flushPoints[w.read] = w.written
+	return w.impl.Flush()
+}
+
+// segments translates the segments of the values written to the segments of the deduplicated values
+func (w *uniqueWriter[T]) segments(segments []Segment) ([]Segment, error) {
+	result := make([]Segment, len(segments))
+	for i, segment := range segments {
+		begin, beginFlushed := w.flushPoints[segment.Begin]
+		end, endFlushed := w.flushPoints[segment.Begin+segment.Length]
+		if !beginFlushed || !endFlushed {
+			// see the requirements of sortOps.firstStage
+			return nil, ErrNotSupported
+		}
+		result[i] = Segment{begin, end - begin}
+	}
+	return result, nil
+}
+
+// doFirstStageUnique runs the first stage with a writer, which drops or combines the equal values of every segment
+func doFirstStageUnique[T any](
+	w sortio.Writer[T],
+	less func(a, b T) bool,
+	combine func(a, b T) T,
+	params Params,
+	firstStage func(w sortio.Writer[T], params Params) ([]Segment, error)) ([]Segment, error) {
+
+	unique := newUniqueWriter(w, less, combine)
+	params.Unique = false
+	segments, err := firstStage(unique, params)
+	if err != nil {
+		return nil, err
+	}
+	return unique.segments(segments)
+}
+
+// dropEqual removes the values equal to the previous value from the sorted values in place
+func dropEqual[T any](values []T, less func(a, b T) bool) []T {
+	if len(values) == 0 {
+		return values
+	}
+	result := values[:1]
+	for _, x := range values[1:] {
+		if less(result[len(result)-1], x) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// DoMultiwayMergeSortCountsContext sorts the values like DoMultiwayMergeSortParamsContext with Params.Unique,
+// but every distinct value is written along with the number of its occurrences in the input.
+// The counts of the equal values are summed up by the first stage and by every merge.
+// Params are expressed in pairs of a value and a count (16 bytes). Compression and the radix sorts are not supported.
+func DoMultiwayMergeSortCountsContext(
+	ctx context.Context,
+	r sortio.Uint64Reader,
+	w sortio.Writer[sortio.ValueCount],
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	params.Unique = true
+	s := newSorter(ctx, params, countsOps(params.Less), profiler)
+	defer s.close()
+	return s.doSort(onesReader{r}, w)
+}
+
+// ResumeMultiwayMergeSortCountsContext continues a sort of DoMultiwayMergeSortCountsContext from the checkpoint
+// (see ResumeMultiwayMergeSortParamsContext).
+func ResumeMultiwayMergeSortCountsContext(
+	ctx context.Context,
+	checkpoint string,
+	w sortio.Writer[sortio.ValueCount],
+	params Params,
+	profiler *util.SimpleProfiler) error {
+
+	params.Unique = true
+	params.Checkpoint = checkpoint
+	s := newSorter(ctx, params, countsOps(params.Less), profiler)
+	defer s.close()
+	return s.resume(w)
+}
+
+// onesReader reads every value with the count of 1
+type onesReader struct {
+	impl sortio.Uint64Reader
+}
+
+func (r onesReader) SetProfiler(p *util.SimpleProfiler) {
+	r.impl.SetProfiler(p)
+}
+
+func (r onesReader) Read() (sortio.ValueCount, error) {
+	x, err := r.impl.ReadUint64()
+	return sortio.ValueCount{Value: x, Count: 1}, err
+}
+
+// countsOps orders the pairs by the values and sums up the counts of the equal values
+func countsOps(lessValues func(a, b uint64) bool) sortOps[sortio.ValueCount] {
+	if lessValues == nil {
+		lessValues = LessUnsigned
+	}
+	less := func(a, b sortio.ValueCount) bool { return lessValues(a.Value, b.Value) }
+	combine := func(a, b sortio.ValueCount) sortio.ValueCount {
+		a.Count += b.Count
+		return a
+	}
+
+	ops := funcOps[sortio.ValueCount](sortio.ValueCountCodec{ByteOrder: binary.NativeEndian}, less)
+	ops.combine = combine
+	ops.firstStage = func(r sortio.Reader[sortio.ValueCount], w sortio.Writer[sortio.ValueCount],
+		params Params) ([]Segment, error) {
+
+		return doFirstStageUnique(w, less, combine, params,
+			func(w sortio.Writer[sortio.ValueCount], params Params) ([]Segment, error) {
+				return DoFirstStageParamsFunc(r, w, less, params)
+			})
+	}
+	return ops
+}
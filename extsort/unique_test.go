@@ -0,0 +1,285 @@
+package extsort
+
+import (
+	"context"
+	sortio "github.com/xosmig/extsort/io"
+	"github.com/xosmig/extsort/util"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func generateValuesWithDuplicates(count int, distinct uint64) []uint64 {
+	result := make([]uint64, count)
+	for i := range result {
+		result[i] = rand.Uint64() % distinct
+	}
+	return result
+}
+
+// distinctSorted returns the distinct values in the order defined by less
+func distinctSorted(values []uint64, less func(a, b uint64) bool) []uint64 {
+	sorted := append([]uint64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return dropEqual(sorted, less)
+}
+
+func TestDoMultiwayMergeSortParams_Unique(t *testing.T) {
+	testcases := []struct {
+		name   string
+		modify func(params *Params)
+	}{
+		{"initialSort", func(params *Params) {}},
+		{"replacementSelection", func(params *Params) { params.UseReplacementSelection = true }},
+		{"parallel", func(params *Params) { params.Parallelism = 3; params.FirstStageMemoryLimit = 30 }},
+		{"lsd", func(params *Params) { params.InMemorySort = LSDRadixSort; params.FirstStageMemoryLimit = 20 }},
+		{"descending", func(params *Params) { params.Less = Reverse(LessUnsigned) }},
+		{"descending_replacementSelection", func(params *Params) {
+			params.Less = Reverse(LessUnsigned)
+			params.UseReplacementSelection = true
+		}},
+		{"compression", func(params *Params) { params.Compression = DeltaCompression }},
+		{"forecasting_checksums", func(params *Params) { params.Forecasting = true; params.Checksums = true }},
+		{"loserTree", func(params *Params) { params.UseLoserTree = true }},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			// a lot of small runs and a small arity to force several merge passes
+			params := Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 10000,
+				FirstStageMemoryLimit:        10,
+				BufferSize:                   2,
+				Unique:                       true,
+			}
+			tc.modify(&params)
+			less := params.Less
+			if less == nil {
+				less = LessUnsigned
+			}
+
+			input := generateValuesWithDuplicates(1000, 100)
+			output := sortio.NewSliceUint64Writer()
+			err := DoMultiwayMergeSortParams(sortio.NewSliceUint64Reader(input), output, params,
+				util.NewNilSimpleProfiler())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			expected := distinctSorted(input, less)
+			if !reflect.DeepEqual(expected, output.Data()) {
+				t.Fatalf("expected: %v, actual: %v", expected, output.Data())
+			}
+		})
+	}
+}
+
+func TestDoFirstStageParams_Unique(t *testing.T) {
+	params := Params{
+		MemoryLimit:                  1000,
+		Arity:                        3,
+		ReserveMemoryForSegmentsInfo: 10000,
+		FirstStageMemoryLimit:        10,
+		BufferSize:                   2,
+		Unique:                       true,
+	}
+	for _, useReplacementSelection := range []bool{false, true} {
+		params.UseReplacementSelection = useReplacementSelection
+		input := generateValuesWithDuplicates(1000, 5)
+		output := sortio.NewSliceUint64Writer()
+		segments, err := DoFirstStageParams(sortio.NewSliceUint64Reader(input), output, params)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// every segment is strictly increasing, and the segments cover the output
+		var begin uint64 = 0
+		for _, segment := range segments {
+			if segment.Begin != begin {
+				t.Fatalf("replacementSelection=%v: expected segment at %v, actual: %v",
+					useReplacementSelection, begin, segment.Begin)
+			}
+			values := output.Data()[segment.Begin : segment.Begin+segment.Length]
+			for i := 1; i < len(values); i++ {
+				if values[i-1] >= values[i] {
+					t.Fatalf("replacementSelection=%v: the segment %+v is not strictly increasing: %v",
+						useReplacementSelection, segment, values)
+				}
+			}
+			begin += segment.Length
+		}
+		if begin != uint64(len(output.Data())) {
+			t.Fatalf("replacementSelection=%v: the segments cover %v values out of %v",
+				useReplacementSelection, begin, len(output.Data()))
+		}
+	}
+}
+
+func TestDoMultiwayMergeSortParams_UniqueStable(t *testing.T) {
+	params := Params{
+		MemoryLimit:                  1000,
+		Arity:                        3,
+		ReserveMemoryForSegmentsInfo: 10000,
+		FirstStageMemoryLimit:        7,
+		BufferSize:                   2,
+		Less:                         lessHighBits,
+		Stable:                       true,
+		Unique:                       true,
+	}
+
+	input := generateValuesWithPositions(1000, 10)
+	output := sortio.NewSliceUint64Writer()
+	err := DoMultiwayMergeSortParams(sortio.NewSliceUint64Reader(input), output, params, util.NewNilSimpleProfiler())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the first occurrence of every key is kept
+	var expected []uint64
+	seen := make(map[uint64]bool)
+	for _, value := range input {
+		if !seen[value>>32] {
+			seen[value>>32] = true
+			expected = append(expected, value)
+		}
+	}
+	sort.Slice(expected, func(i, j int) bool { return lessHighBits(expected[i], expected[j]) })
+	if !reflect.DeepEqual(expected, output.Data()) {
+		t.Fatalf("expected: %x, actual: %x", expected, output.Data())
+	}
+}
+
+func TestDoMultiwayMergeSortRecords_Unique(t *testing.T) {
+	var input [][]byte
+	for _, record := range generateRandomRecords(300) {
+		// every record occurs several times
+		for i := 0; i < 1+rand.Intn(3); i++ {
+			input = append(input, record)
+		}
+	}
+	rand.Shuffle(len(input), func(i, j int) { input[i], input[j] = input[j], input[i] })
+
+	params := Params{
+		MemoryLimit:                  1000,
+		Arity:                        3,
+		ReserveMemoryForSegmentsInfo: 10000,
+		FirstStageMemoryLimit:        10 * (recordOverhead + 16),
+		BufferSize:                   64,
+		Unique:                       true,
+	}
+	output := sortio.NewSliceWriter[[]byte]()
+	err := DoMultiwayMergeSortRecords(sortio.NewSliceReader(input), output, LessBytes, params,
+		util.NewNilSimpleProfiler())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := append([][]byte(nil), input...)
+	sort.Slice(expected, func(i, j int) bool { return LessBytes(expected[i], expected[j]) })
+	expected = dropEqual(expected, LessBytes)
+	if !reflect.DeepEqual(expected, output.Data()) {
+		t.Fatalf("expected: %q, actual: %q", expected, output.Data())
+	}
+}
+
+func TestDoMultiwayMergeSortCountsContext(t *testing.T) {
+	for _, less := range []func(a, b uint64) bool{nil, Reverse(LessUnsigned)} {
+		for _, useReplacementSelection := range []bool{false, true} {
+			params := Params{
+				MemoryLimit:                  1000,
+				Arity:                        3,
+				ReserveMemoryForSegmentsInfo: 10000,
+				FirstStageMemoryLimit:        10,
+				BufferSize:                   2,
+				UseReplacementSelection:      useReplacementSelection,
+				Less:                         less,
+				Forecasting:                  true,
+			}
+
+			input := generateValuesWithDuplicates(1000, 50)
+			output := sortio.NewSliceWriter[sortio.ValueCount]()
+			err := DoMultiwayMergeSortCountsContext(context.Background(), sortio.NewSliceUint64Reader(input), output,
+				params, util.NewNilSimpleProfiler())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if less == nil {
+				less = LessUnsigned
+			}
+			counts := make(map[uint64]uint64)
+			for _, value := range input {
+				counts[value]++
+			}
+			var expected []sortio.ValueCount
+			for _, value := range distinctSorted(input, less) {
+				expected = append(expected, sortio.ValueCount{Value: value, Count: counts[value]})
+			}
+			if !reflect.DeepEqual(expected, output.Data()) {
+				t.Fatalf("replacementSelection=%v: expected: %v, actual: %v",
+					useReplacementSelection, expected, output.Data())
+			}
+		}
+	}
+}
+
+func TestResumeMultiwayMergeSortCountsContext(t *testing.T) {
+	params := checkpointTestParams(t)
+	params.Unique = true
+	input := generateValuesWithDuplicates(1000, 200)
+
+	// the sort fails on the third merge
+	ops := countsOps(nil)
+	merge := ops.merge
+	merges := 0
+	ops.merge = func(readers []sortio.Reader[sortio.ValueCount], w sortio.Writer[sortio.ValueCount], params Params) error {
+		merges++
+		if merges == 3 {
+			return errCrash
+		}
+		return merge(readers, w, params)
+	}
+	s := newSorter(context.Background(), params, ops, util.NewNilSimpleProfiler())
+	err := s.doSort(onesReader{sortio.NewSliceUint64Reader(input)}, sortio.NewSliceWriter[sortio.ValueCount]())
+	s.close()
+	if err != errCrash {
+		t.Fatalf("expected error: %v, actual: %v", errCrash, err)
+	}
+
+	output := sortio.NewSliceWriter[sortio.ValueCount]()
+	err = ResumeMultiwayMergeSortCountsContext(context.Background(), params.Checkpoint, output, params,
+		util.NewNilSimpleProfiler())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	counts := make(map[uint64]uint64)
+	for _, value := range input {
+		counts[value]++
+	}
+	var expected []sortio.ValueCount
+	for _, value := range distinctSorted(input, LessUnsigned) {
+		expected = append(expected, sortio.ValueCount{Value: value, Count: counts[value]})
+	}
+	if !reflect.DeepEqual(expected, output.Data()) {
+		t.Fatalf("expected: %v, actual: %v", expected, output.Data())
+	}
+}
+
+func TestDropEqual(t *testing.T) {
+	testcases := [][2][]uint64{
+		{nil, nil},
+		{{1}, {1}},
+		{{1, 1, 1}, {1}},
+		{{1, 2, 2, 3, 3, 3, 4}, {1, 2, 3, 4}},
+	}
+	for _, tc := range testcases {
+		actual := dropEqual(append([]uint64(nil), tc[0]...), LessUnsigned)
+		if len(actual) != len(tc[1]) || (len(actual) > 0 && !reflect.DeepEqual(tc[1], actual)) {
+			t.Fatalf("expected: %v, actual: %v", tc[1], actual)
+		}
+	}
+}
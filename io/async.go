@@ -0,0 +1,211 @@
+package io
+
+import (
+	"io"
+	"sync"
+)
+
+// AsyncReader reads blocks from the underlying reader on a background goroutine.
+// It uses two blocks: while one of them is consumed, the next one is prefetched.
+// Close must be called to stop the background goroutine if the reader is not read until the end.
+type AsyncReader struct {
+	filled  chan asyncBlock
+	free    chan []byte
+	stop    chan struct{}
+	current []byte // the unread part of the current block
+	block   []byte // the current block, which is returned to the background goroutine when it is consumed
+	err     error
+	closed  bool
+}
+
+type asyncBlock struct {
+	data []byte
+	err  error
+}
+
+func NewAsyncReaderSize(r io.Reader, blockSize int) *AsyncReader {
+	ar := &AsyncReader{
+		filled: make(chan asyncBlock, 2),
+		free:   make(chan []byte, 2),
+		stop:   make(chan struct{}),
+	}
+	ar.free <- make([]byte, blockSize)
+	ar.free <- make([]byte, blockSize)
+	go ar.run(r)
+	return ar
+}
+
+func (r *AsyncReader) run(stream io.Reader) {
+	for {
+		var buf []byte
+		select {
+		case buf = <-r.free:
+		case <-r.stop:
+			return
+		}
+
+		n, err := io.ReadFull(stream, buf[:cap(buf)])
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+
+		select {
+		case r.filled <- asyncBlock{buf[:n], err}:
+		case <-r.stop:
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *AsyncReader) Read(p []byte) (int, error) {
+	for len(r.current) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		if r.block != nil {
+			r.free <- r.block
+			r.block = nil
+		}
+
+		block := <-r.filled
+		r.current, r.block, r.err = block.data, block.data, block.err
+	}
+
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+	return n, nil
+}
+
+// Close stops the background goroutine. It does not close the underlying reader.
+func (r *AsyncReader) Close() error {
+	if !r.closed {
+		r.closed = true
+		close(r.stop)
+	}
+	return nil
+}
+
+// AsyncWriter writes blocks to the underlying writer on a background goroutine.
+// It uses two blocks: while one of them is filled, the other one is written.
+// Sync does not wait for the data to be written, it only schedules the synchronization
+// of the underlying writer after the data written so far.
+// Errors are reported by the subsequent calls. Close waits for all the scheduled operations.
+type AsyncWriter struct {
+	requests chan asyncWriteRequest
+	free     chan []byte
+	done     chan struct{}
+	current  []byte
+	closed   bool
+
+	mutex sync.Mutex
+	err   error
+}
+
+type asyncWriteRequest struct {
+	data []byte
+	sync bool
+}
+
+func NewAsyncWriterSize(w WriteSyncer, blockSize int) *AsyncWriter {
+	aw := &AsyncWriter{
+		requests: make(chan asyncWriteRequest, 2),
+		free:     make(chan []byte, 2),
+		done:     make(chan struct{}),
+	}
+	aw.free <- make([]byte, 0, blockSize)
+	aw.free <- make([]byte, 0, blockSize)
+	go aw.run(w)
+	return aw
+}
+
+func (w *AsyncWriter) run(stream WriteSyncer) {
+	defer close(w.done)
+
+	for request := range w.requests {
+		if w.getErr() == nil {
+			var err error
+			if len(request.data) > 0 {
+				_, err = stream.Write(request.data)
+			}
+			if err == nil && request.sync {
+				err = stream.Sync()
+			}
+			if err != nil {
+				w.setErr(err)
+			}
+		}
+
+		if request.data != nil {
+			w.free <- request.data[:0]
+		}
+	}
+}
+
+func (w *AsyncWriter) getErr() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.err
+}
+
+func (w *AsyncWriter) setErr(err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.err = err
+}
+
+func (w *AsyncWriter) submit(sync bool) {
+	w.requests <- asyncWriteRequest{w.current, sync}
+	w.current = nil
+}
+
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	if err := w.getErr(); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		if w.current == nil {
+			w.current = <-w.free
+		}
+
+		n := copy(w.current[len(w.current):cap(w.current)], p)
+		w.current = w.current[:len(w.current)+n]
+		p = p[n:]
+		written += n
+
+		if len(w.current) == cap(w.current) {
+			w.submit(false)
+		}
+	}
+
+	return written, nil
+}
+
+func (w *AsyncWriter) Sync() error {
+	if err := w.getErr(); err != nil {
+		return err
+	}
+
+	w.submit(true)
+	return nil
+}
+
+// Close waits until all the data is written. It does not close the underlying writer.
+func (w *AsyncWriter) Close() error {
+	if !w.closed {
+		w.closed = true
+		if w.current != nil {
+			w.submit(false)
+		}
+		close(w.requests)
+		<-w.done
+	}
+
+	return w.getErr()
+}
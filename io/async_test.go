@@ -0,0 +1,160 @@
+package io
+
+import (
+	"bytes"
+	"errors"
+	"github.com/xosmig/extsort/util"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+type bufferSyncer struct {
+	bytes.Buffer
+	syncs int
+}
+
+func (b *bufferSyncer) Sync() error {
+	b.syncs++
+	return nil
+}
+
+type failingWriteSyncer struct{}
+
+var errTestWrite = errors.New("test write error")
+
+func (failingWriteSyncer) Write(p []byte) (int, error) { return 0, errTestWrite }
+func (failingWriteSyncer) Sync() error                 { return nil }
+
+func generateBytes(count int) []byte {
+	data := make([]byte, count)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func TestAsyncReader(t *testing.T) {
+	data := generateBytes(1000)
+
+	r := NewAsyncReaderSize(bytes.NewReader(data), 64)
+	defer r.Close()
+
+	dataRead, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(data, dataRead) {
+		t.Fatalf("the data read differs from the original data")
+	}
+}
+
+func TestAsyncReader_CloseBeforeEOF(t *testing.T) {
+	r := NewAsyncReaderSize(bytes.NewReader(generateBytes(1000)), 64)
+
+	buf := make([]byte, 10)
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r.Close()
+	r.Close()
+}
+
+func TestAsyncWriter(t *testing.T) {
+	data := generateBytes(1000)
+	var output bufferSyncer
+
+	w := NewAsyncWriterSize(&output, 64)
+	for i := 0; i < len(data); i += 100 {
+		_, err := w.Write(data[i : i+100])
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		err = w.Sync()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(data, output.Bytes()) {
+		t.Fatalf("the data written differs from the original data")
+	}
+
+	if output.syncs != 10 {
+		t.Fatalf("expected 10 syncs, actual: %v", output.syncs)
+	}
+}
+
+func TestAsyncWriter_Error(t *testing.T) {
+	w := NewAsyncWriterSize(failingWriteSyncer{}, 64)
+	_, err := w.Write(generateBytes(100))
+	if err != nil {
+		t.Fatalf("the error is expected to be reported later, got: %v", err)
+	}
+
+	if err = w.Close(); err != errTestWrite {
+		t.Fatalf("expected error: %v, actual: %v", errTestWrite, err)
+	}
+}
+
+// slowWriteSyncer simulates a disk with a high synchronization latency
+type slowWriteSyncer struct{}
+
+func (slowWriteSyncer) Write(p []byte) (int, error) { return len(p), nil }
+func (slowWriteSyncer) Sync() error {
+	time.Sleep(200 * time.Microsecond)
+	return nil
+}
+
+func benchmarkBinaryUint64WriterIORatio(b *testing.B, async bool) {
+	const count = 1024 * 1024
+
+	var ioRatio float64 = 0
+	for n := 0; n < b.N; n++ {
+		var stream WriteSyncer = slowWriteSyncer{}
+		var asyncWriter *AsyncWriter
+		if async {
+			asyncWriter = NewAsyncWriterSize(stream, DefaultBufValuesCount*SizeOfValue)
+			stream = asyncWriter
+		}
+
+		profiler := util.NewSimpleProfiler()
+		w := NewBinaryUint64Writer(stream)
+		w.SetProfiler(profiler)
+
+		profiler.Start()
+		value := uint64(0)
+		for i := 0; i < count; i++ {
+			// some computation to overlap the io with
+			for j := 0; j < 50; j++ {
+				value = value*6364136223846793005 + 1442695040888963407
+			}
+			w.WriteUint64(value)
+		}
+		w.Flush()
+		if asyncWriter != nil {
+			asyncWriter.Close()
+		}
+		profiler.Finish()
+
+		ioRatio += profiler.GetMeasuredDurationRatio()
+	}
+	b.ReportMetric(ioRatio/float64(b.N), "io-ratio")
+}
+
+func BenchmarkBinaryUint64Writer_SlowSync(b *testing.B) {
+	benchmarkBinaryUint64WriterIORatio(b, false)
+}
+
+func BenchmarkBinaryUint64Writer_SlowSync_Async(b *testing.B) {
+	benchmarkBinaryUint64WriterIORatio(b, true)
+}
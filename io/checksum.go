@@ -0,0 +1,149 @@
+package io
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The checksummed format splits the data into blocks of a fixed size (the last block may be shorter).
+// Each block is followed by the CRC32C checksum of the block in little-endian byte order.
+
+const ChecksumSize = 4
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ChecksumError is returned when the data read by ChecksumReader does not match its checksum
+type ChecksumError struct {
+	File   string
+	Offset int64 // the offset of the corrupted block in the file
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch in %v: the block at offset %v is corrupted", e.File, e.Offset)
+}
+
+// ChecksumWriter writes the data in the checksummed format.
+// Close must be called to write the last incomplete block.
+type ChecksumWriter struct {
+	stream    WriteSyncer
+	buf       []byte
+	filled    int
+	blockSize int
+}
+
+func NewChecksumWriterSize(w WriteSyncer, blockSize int) *ChecksumWriter {
+	return &ChecksumWriter{
+		stream:    w,
+		buf:       make([]byte, blockSize+ChecksumSize),
+		blockSize: blockSize,
+	}
+}
+
+func (w *ChecksumWriter) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		n := copy(w.buf[w.filled:w.blockSize], p)
+		w.filled += n
+		p = p[n:]
+
+		if w.filled == w.blockSize {
+			if err := w.writeBlock(); err != nil {
+				return total - len(p), err
+			}
+		}
+	}
+	return total, nil
+}
+
+func (w *ChecksumWriter) writeBlock() error {
+	binary.LittleEndian.PutUint32(w.buf[w.filled:], crc32.Checksum(w.buf[:w.filled], castagnoliTable))
+	_, err := w.stream.Write(w.buf[:w.filled+ChecksumSize])
+	w.filled = 0
+	return err
+}
+
+// Sync syncs the complete blocks. The incomplete block is kept in memory until Close.
+func (w *ChecksumWriter) Sync() error {
+	return w.stream.Sync()
+}
+
+// Close writes the last incomplete block. It does not close the underlying writer.
+func (w *ChecksumWriter) Close() error {
+	if w.filled == 0 {
+		return nil
+	}
+	return w.writeBlock()
+}
+
+// ChecksumReader reads the data written by ChecksumWriter and verifies the checksums
+type ChecksumReader struct {
+	stream  io.Reader
+	name    string
+	buf     []byte
+	current []byte // the unread part of the current block
+	offset  int64  // the offset of the next block in the file
+	skip    int    // the number of bytes to skip in the first block
+	err     error
+}
+
+// NewChecksumReaderAt seeks to the given offset in the data (not in the file) and returns a reader of the rest
+// of the data. The name is used in the errors.
+func NewChecksumReaderAt(r io.ReadSeeker, name string, blockSize int, offset int64) (*ChecksumReader, error) {
+	blockOffset := offset / int64(blockSize) * int64(blockSize+ChecksumSize)
+	if _, err := r.Seek(blockOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return &ChecksumReader{
+		stream: r,
+		name:   name,
+		buf:    make([]byte, blockSize+ChecksumSize),
+		offset: blockOffset,
+		skip:   int(offset % int64(blockSize)),
+	}, nil
+}
+
+func (r *ChecksumReader) Read(p []byte) (int, error) {
+	for len(r.current) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.readBlock()
+	}
+
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+	return n, nil
+}
+
+func (r *ChecksumReader) readBlock() error {
+	n, err := io.ReadFull(r.stream, r.buf)
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	// the last block is shorter, the next read returns io.EOF
+
+	blockOffset := r.offset
+	r.offset += int64(n)
+	if n <= ChecksumSize {
+		// the writer never writes empty blocks
+		return &ChecksumError{File: r.name, Offset: blockOffset}
+	}
+
+	block := r.buf[:n-ChecksumSize]
+	if crc32.Checksum(block, castagnoliTable) != binary.LittleEndian.Uint32(r.buf[n-ChecksumSize:n]) {
+		return &ChecksumError{File: r.name, Offset: blockOffset}
+	}
+
+	if r.skip > len(block) {
+		r.skip = len(block)
+	}
+	r.current = block[r.skip:]
+	r.skip = 0
+	return nil
+}
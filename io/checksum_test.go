@@ -0,0 +1,87 @@
+package io
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func writeChecksummed(t *testing.T, data []byte, blockSize int) []byte {
+	var buf bufferSyncer
+	w := NewChecksumWriterSize(&buf, blockSize)
+	// write in pieces not aligned with the blocks
+	for begin := 0; begin < len(data); begin += 100 {
+		end := begin + 100
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := w.Write(data[begin:end]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestChecksumIO_WriteAndRead(t *testing.T) {
+	for _, size := range []int{0, 1, 64, 1000, 1024} {
+		data := generateBytes(size)
+		encoded := writeChecksummed(t, data, 64)
+
+		for _, offset := range []int{0, 1, 63, 64, 65, size / 2, size} {
+			if offset > size {
+				continue
+			}
+
+			r, err := NewChecksumReaderAt(bytes.NewReader(encoded), "test", 64, int64(offset))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			dataRead, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("size %v, offset %v: unexpected error: %v", size, offset, err)
+			}
+			if !bytes.Equal(data[offset:], dataRead) {
+				t.Fatalf("size %v, offset %v: the data read differs from the original data", size, offset)
+			}
+		}
+	}
+}
+
+func TestChecksumReader_Corrupted(t *testing.T) {
+	encoded := writeChecksummed(t, generateBytes(1000), 64)
+	// corrupt the third block
+	encoded[2*(64+ChecksumSize)+10]++
+
+	r, err := NewChecksumReaderAt(bytes.NewReader(encoded), "test", 64, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = ioutil.ReadAll(r)
+
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("expected a checksum error, actual: %v", err)
+	}
+	if checksumErr.File != "test" || checksumErr.Offset != 2*(64+ChecksumSize) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestChecksumReader_Truncated(t *testing.T) {
+	encoded := writeChecksummed(t, generateBytes(1000), 64)
+
+	r, err := NewChecksumReaderAt(bytes.NewReader(encoded[:len(encoded)-10]), "test", 64, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = ioutil.ReadAll(r)
+
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("expected a checksum error, actual: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package io
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Codec describes a fixed-size binary representation of values of type T.
+// It is used by BinaryReader and BinaryWriter and for the temporary files of the sorting algorithm.
+type Codec[T any] interface {
+	// Size returns the number of bytes used to encode a single value.
+	Size() int
+	// Encode writes x to the first Size() bytes of buf.
+	Encode(buf []byte, x T)
+	// Decode reads a value from the first Size() bytes of buf.
+	Decode(buf []byte) T
+}
+
+type Uint64Codec struct{}
+
+func (Uint64Codec) Size() int                   { return SizeOfValue }
+func (Uint64Codec) Encode(buf []byte, x uint64) { binary.LittleEndian.PutUint64(buf, x) }
+func (Uint64Codec) Decode(buf []byte) uint64    { return binary.LittleEndian.Uint64(buf) }
+
+// NativeUint64Codec stores values in the byte order of the machine.
+// It is used for the temporary files, which are never read on another machine.
+type NativeUint64Codec struct{}
+
+func (NativeUint64Codec) Size() int                   { return SizeOfValue }
+func (NativeUint64Codec) Encode(buf []byte, x uint64) { binary.NativeEndian.PutUint64(buf, x) }
+func (NativeUint64Codec) Decode(buf []byte) uint64    { return binary.NativeEndian.Uint64(buf) }
+
+type Int64Codec struct{}
+
+func (Int64Codec) Size() int                  { return 8 }
+func (Int64Codec) Encode(buf []byte, x int64) { binary.LittleEndian.PutUint64(buf, uint64(x)) }
+func (Int64Codec) Decode(buf []byte) int64    { return int64(binary.LittleEndian.Uint64(buf)) }
+
+type Float64Codec struct{}
+
+func (Float64Codec) Size() int { return 8 }
+
+func (Float64Codec) Encode(buf []byte, x float64) {
+	binary.LittleEndian.PutUint64(buf, math.Float64bits(x))
+}
+
+func (Float64Codec) Decode(buf []byte) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf))
+}
+
+// FixedBytesCodec encodes byte keys of exactly Length bytes.
+// Decode returns a fresh copy, so the decoded keys can be retained by the caller.
+type FixedBytesCodec struct {
+	Length int
+}
+
+func (c FixedBytesCodec) Size() int { return c.Length }
+
+func (c FixedBytesCodec) Encode(buf []byte, x []byte) {
+	if len(x) != c.Length {
+		panic("FixedBytesCodec: invalid key length")
+	}
+	copy(buf, x)
+}
+
+func (c FixedBytesCodec) Decode(buf []byte) []byte {
+	result := make([]byte, c.Length)
+	copy(result, buf)
+	return result
+}
+
+// ValueCount is a value along with the number of its occurrences
+type ValueCount struct {
+	Value uint64
+	Count uint64
+}
+
+// ValueCountCodec stores the value followed by the count in the byte order (little-endian if nil)
+type ValueCountCodec struct {
+	ByteOrder binary.ByteOrder
+}
+
+func (c ValueCountCodec) Size() int { return 2 * SizeOfValue }
+
+func (c ValueCountCodec) order() binary.ByteOrder {
+	if c.ByteOrder == nil {
+		return binary.LittleEndian
+	}
+	return c.ByteOrder
+}
+
+func (c ValueCountCodec) Encode(buf []byte, x ValueCount) {
+	order := c.order()
+	order.PutUint64(buf, x.Value)
+	order.PutUint64(buf[SizeOfValue:], x.Count)
+}
+
+func (c ValueCountCodec) Decode(buf []byte) ValueCount {
+	order := c.order()
+	return ValueCount{order.Uint64(buf), order.Uint64(buf[SizeOfValue:])}
+}
+
+func NewByteBuf[T any](codec Codec[T], count int) []byte {
+	return make([]byte, count*codec.Size())
+}
@@ -1,5 +1,7 @@
 package io
 
+import "encoding/binary"
+
 const (
 	DefaultBufValuesCount = 4096
 	SizeOfValue           = 8
@@ -9,6 +11,13 @@ func NewUint64ByteBuf(count int) []byte {
 	return make([]byte, count*SizeOfValue)
 }
 
+// isNativeOrder reports whether the values in the byte order can be copied from memory as is
+func isNativeOrder(order binary.ByteOrder) bool {
+	var buf [SizeOfValue]byte
+	order.PutUint64(buf[:], 1)
+	return binary.NativeEndian.Uint64(buf[:]) == 1
+}
+
 func CopyValues(r Uint64Reader, w Uint64Writer) error {
 	var value uint64
 	var err error
@@ -2,6 +2,7 @@ package io
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"math/rand"
@@ -49,6 +50,32 @@ func TestBinaryUint64IO_WriteAndRead(t *testing.T) {
 	}
 }
 
+func TestBinaryUint64IO_ByteOrder(t *testing.T) {
+	data := []uint64{0x0102030405060708, 1, ^uint64(0)}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian, binary.NativeEndian} {
+		var buf bufferSyncer
+		w := NewBinaryUint64WriterCountBufOrder(&buf, 2, NewUint64ByteBuf(2), order)
+		for _, value := range data {
+			if err := w.WriteUint64(value); err != nil {
+				t.Fatalf("error writing data: %v", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("error writing data: %v", err)
+		}
+
+		if order.Uint64(buf.Bytes()) != data[0] {
+			t.Fatalf("%v: unexpected bytes: %v", order, buf.Bytes()[:SizeOfValue])
+		}
+
+		r := NewBinaryUint64ReaderCountBufOrder(bytes.NewReader(buf.Bytes()), 2, NewUint64ByteBuf(2), order)
+		if dataRead := readAllUint64(t, r); !reflect.DeepEqual(data, dataRead) {
+			t.Fatalf("%v: expected: %v, got: %v", order, data, dataRead)
+		}
+	}
+}
+
 func TestSliceUint64IO_WriteAndRead(t *testing.T) {
 	data := []uint64{2326, 141, 15, 824, 9652, 2, 1882, 344, 152, 85}
 
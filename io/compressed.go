@@ -0,0 +1,235 @@
+package io
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"github.com/xosmig/extsort/util"
+	"io"
+)
+
+// The compressed format consists of blocks of uint64 values. Each block starts with a header of 3 little-endian
+// uint32 numbers: the number of values, the size of the encoded values and the size of the stored data,
+// which follows the header. The values are encoded as zigzag varints of the differences between adjacent values
+// (the first value of a block is encoded as is), so that sorted values with small gaps take 1-3 bytes each.
+// The stored data is either the encoded values or the encoded values compressed by flate.
+
+const compressedHeaderSize = 12
+
+var ErrCorruptedBlock = errors.New("corrupted compressed block")
+
+// CompressedUint64Writer writes uint64 values in the compressed format.
+// Flush completes the current block, so that the values written after it can be read starting from the next block
+// (see SeekOffset).
+type CompressedUint64Writer struct {
+	stream     WriteSyncer
+	valuesBuf  []uint64
+	encodeBuf  []byte
+	flate      *flate.Writer
+	flateBuf   bytes.Buffer
+	written    uint64
+	offset     int64
+	seekPoints map[uint64]int64
+	profiler   *util.SimpleProfiler
+}
+
+// NewCompressedUint64WriterCount creates a writer, which puts up to count values into a block.
+// If useFlate is set, the blocks are additionally compressed by flate.
+func NewCompressedUint64WriterCount(w WriteSyncer, count int, useFlate bool) *CompressedUint64Writer {
+	cw := &CompressedUint64Writer{
+		stream:     w,
+		valuesBuf:  make([]uint64, 0, count),
+		encodeBuf:  make([]byte, compressedHeaderSize+count*binary.MaxVarintLen64),
+		seekPoints: map[uint64]int64{0: 0},
+		profiler:   util.NewNilSimpleProfiler(),
+	}
+	if useFlate {
+		// the temporary files are read once, so the compression speed matters more than the ratio
+		cw.flate, _ = flate.NewWriter(nil, flate.BestSpeed)
+	}
+	return cw
+}
+
+func (w *CompressedUint64Writer) SetProfiler(p *util.SimpleProfiler) {
+	w.profiler = p
+}
+
+// SeekOffset returns the offset in bytes of the block starting with the value with the given index
+// if the block was started by Flush (or it is the first block).
+func (w *CompressedUint64Writer) SeekOffset(index uint64) (int64, bool) {
+	offset, ok := w.seekPoints[index]
+	return offset, ok
+}
+
+func (w *CompressedUint64Writer) writeBlock() error {
+	count := len(w.valuesBuf)
+	if count == 0 {
+		return nil
+	}
+
+	encoded := w.encodeBuf[compressedHeaderSize:compressedHeaderSize]
+	var prev uint64 = 0
+	for _, value := range w.valuesBuf {
+		encoded = binary.AppendVarint(encoded, int64(value-prev))
+		prev = value
+	}
+
+	block := w.encodeBuf[:compressedHeaderSize+len(encoded)]
+	if w.flate != nil {
+		w.flateBuf.Reset()
+		w.flateBuf.Write(w.encodeBuf[:compressedHeaderSize])
+		w.flate.Reset(&w.flateBuf)
+		if _, err := w.flate.Write(encoded); err != nil {
+			return err
+		}
+		if err := w.flate.Close(); err != nil {
+			return err
+		}
+		block = w.flateBuf.Bytes()
+	}
+	binary.LittleEndian.PutUint32(block[0:], uint32(count))
+	binary.LittleEndian.PutUint32(block[4:], uint32(len(encoded)))
+	binary.LittleEndian.PutUint32(block[8:], uint32(len(block)-compressedHeaderSize))
+
+	w.profiler.StartMeasuring()
+	_, err := w.stream.Write(block)
+	w.profiler.FinishMeasuring()
+	if err != nil {
+		return err
+	}
+
+	w.profiler.AddCompressed(count*SizeOfValue, len(block))
+	w.written += uint64(count)
+	w.offset += int64(len(block))
+	w.valuesBuf = w.valuesBuf[:0]
+	return nil
+}
+
+// Flush writes the current block to the stream without syncing it (see BinaryUint64Writer.Flush).
+func (w *CompressedUint64Writer) Flush() error {
+	if err := w.writeBlock(); err != nil {
+		return err
+	}
+	w.seekPoints[w.written] = w.offset
+	return nil
+}
+
+func (w *CompressedUint64Writer) WriteUint64(x uint64) error {
+	if len(w.valuesBuf) == cap(w.valuesBuf) {
+		if err := w.writeBlock(); err != nil {
+			return err
+		}
+	}
+
+	w.valuesBuf = append(w.valuesBuf, x)
+	return nil
+}
+
+func (w *CompressedUint64Writer) Write(x uint64) error {
+	return w.WriteUint64(x)
+}
+
+// CompressedUint64Reader reads uint64 values written by CompressedUint64Writer
+type CompressedUint64Reader struct {
+	stream     io.Reader
+	header     [compressedHeaderSize]byte
+	storedBuf  []byte
+	encodedBuf []byte
+	flate      io.ReadCloser
+	valuesBuf  []uint64
+	valuesTail []uint64
+	profiler   *util.SimpleProfiler
+}
+
+// NewCompressedUint64ReaderCount creates a reader of blocks of up to count values (larger blocks are supported as well).
+// useFlate must match the writer.
+func NewCompressedUint64ReaderCount(r io.Reader, count int, useFlate bool) *CompressedUint64Reader {
+	cr := &CompressedUint64Reader{
+		stream:    r,
+		valuesBuf: make([]uint64, count),
+		profiler:  util.NewNilSimpleProfiler(),
+	}
+	if useFlate {
+		cr.flate = flate.NewReader(bytes.NewReader(nil))
+	}
+	return cr
+}
+
+func (r *CompressedUint64Reader) SetProfiler(p *util.SimpleProfiler) {
+	r.profiler = p
+}
+
+func growBytes(buf []byte, size int) []byte {
+	if cap(buf) < size {
+		return make([]byte, size)
+	}
+	return buf[:size]
+}
+
+func (r *CompressedUint64Reader) fillEmpty() error {
+	r.profiler.StartMeasuring()
+	_, err := io.ReadFull(r.stream, r.header[:])
+	if err == nil {
+		r.storedBuf = growBytes(r.storedBuf, int(binary.LittleEndian.Uint32(r.header[8:])))
+		_, err = io.ReadFull(r.stream, r.storedBuf)
+	}
+	r.profiler.FinishMeasuring()
+
+	if err == io.ErrUnexpectedEOF {
+		return ErrCorruptedBlock
+	}
+	if err != nil {
+		return err
+	}
+
+	count := int(binary.LittleEndian.Uint32(r.header[0:]))
+	encoded := r.storedBuf
+	if r.flate != nil {
+		r.encodedBuf = growBytes(r.encodedBuf, int(binary.LittleEndian.Uint32(r.header[4:])))
+		if err := r.flate.(flate.Resetter).Reset(bytes.NewReader(r.storedBuf), nil); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r.flate, r.encodedBuf); err != nil {
+			return ErrCorruptedBlock
+		}
+		encoded = r.encodedBuf
+	}
+
+	if cap(r.valuesBuf) < count {
+		r.valuesBuf = make([]uint64, count)
+	}
+	values := r.valuesBuf[:count]
+	var prev uint64 = 0
+	for i := range values {
+		delta, n := binary.Varint(encoded)
+		if n <= 0 {
+			return ErrCorruptedBlock
+		}
+		encoded = encoded[n:]
+		prev += uint64(delta)
+		values[i] = prev
+	}
+	if len(encoded) != 0 || count == 0 {
+		return ErrCorruptedBlock
+	}
+
+	r.valuesTail = values
+	return nil
+}
+
+func (r *CompressedUint64Reader) ReadUint64() (uint64, error) {
+	if len(r.valuesTail) == 0 {
+		if err := r.fillEmpty(); err != nil {
+			return 0, err
+		}
+	}
+
+	value := r.valuesTail[0]
+	r.valuesTail = r.valuesTail[1:]
+	return value, nil
+}
+
+func (r *CompressedUint64Reader) Read() (uint64, error) {
+	return r.ReadUint64()
+}
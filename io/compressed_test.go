@@ -0,0 +1,145 @@
+package io
+
+import (
+	"bytes"
+	"github.com/xosmig/extsort/util"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func readAllUint64(t *testing.T, r Uint64Reader) []uint64 {
+	var result []uint64
+	for {
+		value, err := r.ReadUint64()
+		if err == io.EOF {
+			return result
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		result = append(result, value)
+	}
+}
+
+func TestCompressedUint64IO_WriteAndRead(t *testing.T) {
+	sorted := make([]uint64, 1000)
+	for i := range sorted {
+		sorted[i] = uint64(i * 3)
+	}
+	random := make([]uint64, 1000)
+	for i := range random {
+		random[i] = rand.Uint64()
+	}
+
+	for _, useFlate := range []bool{false, true} {
+		for _, data := range [][]uint64{nil, {0}, {^uint64(0), 0, ^uint64(0)}, sorted, random} {
+			var buf bufferSyncer
+			w := NewCompressedUint64WriterCount(&buf, 64, useFlate)
+			for _, value := range data {
+				if err := w.WriteUint64(value); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			dataRead := readAllUint64(t, NewCompressedUint64ReaderCount(bytes.NewReader(buf.Bytes()), 64, useFlate))
+			if len(data) != len(dataRead) || (len(data) > 0 && !reflect.DeepEqual(data, dataRead)) {
+				t.Fatalf("flate: %v, the data read differs from the original data", useFlate)
+			}
+		}
+	}
+}
+
+func TestCompressedUint64Writer_SeekOffset(t *testing.T) {
+	var buf bufferSyncer
+	w := NewCompressedUint64WriterCount(&buf, 64, false)
+	// the segments do not fit into a single block
+	for segment := 0; segment < 3; segment++ {
+		for i := 0; i < 100; i++ {
+			if err := w.WriteUint64(uint64(segment*1000 + i)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if _, ok := w.SeekOffset(150); ok {
+		t.Fatalf("expected no offset for a value in the middle of a block")
+	}
+	offset, ok := w.SeekOffset(200)
+	if !ok {
+		t.Fatalf("expected an offset for the beginning of a segment")
+	}
+
+	r := NewBoundedUint64Reader(NewCompressedUint64ReaderCount(bytes.NewReader(buf.Bytes()[offset:]), 64, false), 100)
+	dataRead := readAllUint64(t, r)
+	if len(dataRead) != 100 || dataRead[0] != 2000 || dataRead[99] != 2099 {
+		t.Fatalf("unexpected data: %v", dataRead)
+	}
+}
+
+func TestCompressedUint64Writer_CompressionRatio(t *testing.T) {
+	profiler := util.NewSimpleProfiler()
+	profiler.Start()
+
+	var buf bufferSyncer
+	w := NewCompressedUint64WriterCount(&buf, 1024, false)
+	w.SetProfiler(profiler)
+	for i := 0; i < 10000; i++ {
+		if err := w.WriteUint64(uint64(i)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 1 byte per value and the headers of the blocks
+	if ratio := profiler.GetCompressionRatio(); ratio < 7 {
+		t.Fatalf("expected compression ratio of at least 7, actual: %v", ratio)
+	}
+}
+
+func TestCompressedUint64Reader_Corrupted(t *testing.T) {
+	var buf bufferSyncer
+	w := NewCompressedUint64WriterCount(&buf, 64, false)
+	for i := 0; i < 10; i++ {
+		w.WriteUint64(uint64(i))
+	}
+	w.Flush()
+
+	r := NewCompressedUint64ReaderCount(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), 64, false)
+	if _, err := r.ReadUint64(); err != ErrCorruptedBlock {
+		t.Fatalf("expected error: %v, actual: %v", ErrCorruptedBlock, err)
+	}
+}
+
+type discardWriteSyncer struct{}
+
+func (discardWriteSyncer) Write(p []byte) (int, error) { return len(p), nil }
+func (discardWriteSyncer) Sync() error                 { return nil }
+
+func BenchmarkCompressedUint64Writer(b *testing.B) {
+	for _, useFlate := range []bool{false, true} {
+		name := "delta"
+		if useFlate {
+			name = "flate"
+		}
+		b.Run(name, func(b *testing.B) {
+			w := NewCompressedUint64WriterCount(discardWriteSyncer{}, DefaultBufValuesCount, useFlate)
+			var value uint64 = 0
+			b.SetBytes(SizeOfValue)
+			for n := 0; n < b.N; n++ {
+				value += uint64(rand.Intn(1000))
+				w.WriteUint64(value)
+			}
+			w.Flush()
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package io
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/xosmig/extsort/util"
+	"io"
+)
+
+// The delta format is a compact format for sorted uint64 values. It starts with a header of 16 bytes:
+//   - the magic string "XSDV";
+//   - the version of the format (1);
+//   - the encoding of the blocks (see DeltaEncoding);
+//   - 2 reserved zero bytes;
+//   - the number of values as a little-endian uint64 or DeltaUnknownCount if the file was written to a stream,
+//     which cannot be written at an offset (e.g. a pipe or a file opened with O_APPEND).
+//
+// The header is followed by the blocks of the compressed format of CompressedUint64Writer.
+// Any sequence of values can be stored, but only sorted ones take 1-3 bytes per value.
+
+const deltaMagic = "XSDV"
+const deltaVersion = 1
+const deltaHeaderSize = 16
+const deltaCountOffset = 8
+
+// DeltaUnknownCount is stored in the header if the number of values is unknown
+const DeltaUnknownCount = ^uint64(0)
+
+var ErrInvalidDeltaHeader = errors.New("invalid header of the delta format")
+
+type DeltaEncoding byte
+
+const (
+	// DeltaVarint stores the differences between adjacent values as zigzag varints
+	DeltaVarint DeltaEncoding = iota
+	// DeltaVarintFlate additionally compresses the blocks by flate
+	DeltaVarintFlate
+)
+
+// DeltaUint64Writer writes values in the delta format.
+type DeltaUint64Writer struct {
+	stream        WriteSyncer
+	impl          *CompressedUint64Writer
+	encoding      DeltaEncoding
+	headerWritten bool
+	headerOffset  int64
+	count         uint64
+}
+
+func NewDeltaUint64WriterCount(w WriteSyncer, count int, encoding DeltaEncoding) *DeltaUint64Writer {
+	return &DeltaUint64Writer{
+		stream:   w,
+		impl:     NewCompressedUint64WriterCount(w, count, encoding == DeltaVarintFlate),
+		encoding: encoding,
+	}
+}
+
+func (w *DeltaUint64Writer) SetProfiler(p *util.SimpleProfiler) {
+	w.impl.SetProfiler(p)
+}
+
+func (w *DeltaUint64Writer) writeHeader() error {
+	w.headerWritten = true
+	w.headerOffset = -1
+	seeker, isSeeker := w.stream.(io.Seeker)
+	writerAt, isWriterAt := w.stream.(io.WriterAt)
+	if isSeeker && isWriterAt {
+		// pipes and terminals fail to seek, so the number of values remains unknown
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		// the files opened with O_APPEND write at the end regardless of the offset, and os.File refuses WriteAt
+		// for them even if there is nothing to write
+		if err == nil {
+			if _, err = writerAt.WriteAt(nil, offset); err == nil {
+				w.headerOffset = offset
+			}
+		}
+	}
+
+	var header [deltaHeaderSize]byte
+	copy(header[:], deltaMagic)
+	header[4] = deltaVersion
+	header[5] = byte(w.encoding)
+	binary.LittleEndian.PutUint64(header[deltaCountOffset:], DeltaUnknownCount)
+	_, err := w.stream.Write(header[:])
+	return err
+}
+
+func (w *DeltaUint64Writer) WriteUint64(x uint64) error {
+	if !w.headerWritten {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	w.count++
+	return w.impl.WriteUint64(x)
+}
+
+func (w *DeltaUint64Writer) Write(x uint64) error {
+	return w.WriteUint64(x)
+}
+
+// Flush writes the buffered values and the number of values written so far to the header
+// if the stream can be written at the offset of the header
+func (w *DeltaUint64Writer) Flush() error {
+	if !w.headerWritten {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+	if err := w.writeCount(); err != nil {
+		return err
+	}
+	return w.impl.Flush()
+}
+
+func (w *DeltaUint64Writer) writeCount() error {
+	if w.headerOffset < 0 {
+		return nil
+	}
+
+	var count [8]byte
+	binary.LittleEndian.PutUint64(count[:], w.count)
+	_, err := w.stream.(io.WriterAt).WriteAt(count[:], w.headerOffset+deltaCountOffset)
+	return err
+}
+
+// DeltaUint64Reader reads values in the delta format.
+// If the header declares the number of values, the reader checks that the file is not truncated.
+type DeltaUint64Reader struct {
+	stream     io.Reader
+	count      int
+	impl       *CompressedUint64Reader
+	profiler   *util.SimpleProfiler
+	total      uint64
+	read       uint64
+	headerRead bool
+}
+
+func NewDeltaUint64ReaderCount(r io.Reader, count int) *DeltaUint64Reader {
+	return &DeltaUint64Reader{
+		stream:   r,
+		count:    count,
+		profiler: util.NewNilSimpleProfiler(),
+	}
+}
+
+func (r *DeltaUint64Reader) SetProfiler(p *util.SimpleProfiler) {
+	r.profiler = p
+	if r.impl != nil {
+		r.impl.SetProfiler(p)
+	}
+}
+
+func (r *DeltaUint64Reader) readHeader() error {
+	var header [deltaHeaderSize]byte
+	if _, err := io.ReadFull(r.stream, header[:]); err != nil {
+		return ErrInvalidDeltaHeader
+	}
+	if string(header[:4]) != deltaMagic || header[4] != deltaVersion {
+		return ErrInvalidDeltaHeader
+	}
+
+	encoding := DeltaEncoding(header[5])
+	if encoding != DeltaVarint && encoding != DeltaVarintFlate {
+		return ErrInvalidDeltaHeader
+	}
+	r.total = binary.LittleEndian.Uint64(header[deltaCountOffset:])
+	r.impl = NewCompressedUint64ReaderCount(r.stream, r.count, encoding == DeltaVarintFlate)
+	r.impl.SetProfiler(r.profiler)
+	r.headerRead = true
+	return nil
+}
+
+// Count returns the number of values declared by the header or DeltaUnknownCount
+func (r *DeltaUint64Reader) Count() (uint64, error) {
+	if !r.headerRead {
+		if err := r.readHeader(); err != nil {
+			return 0, err
+		}
+	}
+	return r.total, nil
+}
+
+func (r *DeltaUint64Reader) ReadUint64() (uint64, error) {
+	if !r.headerRead {
+		if err := r.readHeader(); err != nil {
+			return 0, err
+		}
+	}
+
+	value, err := r.impl.ReadUint64()
+	if err == io.EOF && r.total != DeltaUnknownCount && r.read != r.total {
+		return 0, fmt.Errorf("the header declares %v values, but the file contains %v values", r.total, r.read)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if r.read == r.total {
+		return 0, fmt.Errorf("the header declares %v values, but the file contains more values", r.total)
+	}
+	r.read++
+	return value, nil
+}
+
+func (r *DeltaUint64Reader) Read() (uint64, error) {
+	return r.ReadUint64()
+}
@@ -0,0 +1,150 @@
+package io
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeDeltaFile(t *testing.T, data []uint64, encoding DeltaEncoding) []byte {
+	f, err := os.Create(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	w := NewDeltaUint64WriterCount(f, 64, encoding)
+	for _, value := range data {
+		if err := w.WriteUint64(value); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return content
+}
+
+func TestDeltaUint64IO_WriteAndRead(t *testing.T) {
+	sorted := make([]uint64, 1000)
+	for i := range sorted {
+		sorted[i] = uint64(i * 7)
+	}
+
+	for _, encoding := range []DeltaEncoding{DeltaVarint, DeltaVarintFlate} {
+		for _, data := range [][]uint64{nil, {42}, {^uint64(0), 0}, sorted} {
+			r := NewDeltaUint64ReaderCount(bytes.NewReader(writeDeltaFile(t, data, encoding)), 64)
+			count, err := r.Count()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if count != uint64(len(data)) {
+				t.Fatalf("expected count: %v, actual: %v", len(data), count)
+			}
+
+			dataRead := readAllUint64(t, r)
+			if len(data) != len(dataRead) || (len(data) > 0 && !reflect.DeepEqual(data, dataRead)) {
+				t.Fatalf("encoding: %v, the data read differs from the original data", encoding)
+			}
+		}
+	}
+}
+
+func TestDeltaUint64IO_Stream(t *testing.T) {
+	data := []uint64{1, 2, 3, 5, 8, 13}
+
+	var buf bufferSyncer
+	w := NewDeltaUint64WriterCount(&buf, 4, DeltaVarint)
+	for _, value := range data {
+		w.WriteUint64(value)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := NewDeltaUint64ReaderCount(bytes.NewReader(buf.Bytes()), 4)
+	if count, _ := r.Count(); count != DeltaUnknownCount {
+		t.Fatalf("expected unknown count, actual: %v", count)
+	}
+	if dataRead := readAllUint64(t, r); !reflect.DeepEqual(data, dataRead) {
+		t.Fatalf("expected: %v, actual: %v", data, dataRead)
+	}
+}
+
+func TestDeltaUint64IO_Append(t *testing.T) {
+	data := []uint64{1, 2, 3, 5, 8, 13}
+	prefix := []byte("existing content")
+	filename := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(filename, prefix, 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the file opened with O_APPEND cannot be written at the offset of the header, so the count stays unknown
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w := NewDeltaUint64WriterCount(NewSyncWriter(f, SyncPolicy{Mode: SyncNever}), 4, DeltaVarint)
+	for _, value := range data {
+		if err := w.WriteUint64(value); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.HasPrefix(content, prefix) {
+		t.Fatalf("the existing content is overwritten: %q", content)
+	}
+	r := NewDeltaUint64ReaderCount(bytes.NewReader(content[len(prefix):]), 4)
+	if count, _ := r.Count(); count != DeltaUnknownCount {
+		t.Fatalf("expected unknown count, actual: %v", count)
+	}
+	if dataRead := readAllUint64(t, r); !reflect.DeepEqual(data, dataRead) {
+		t.Fatalf("expected: %v, actual: %v", data, dataRead)
+	}
+}
+
+func TestDeltaUint64Reader_CountMismatch(t *testing.T) {
+	content := writeDeltaFile(t, []uint64{1, 2, 3}, DeltaVarint)
+
+	for _, count := range []uint64{2, 4} {
+		corrupted := append([]byte(nil), content...)
+		binary.LittleEndian.PutUint64(corrupted[deltaCountOffset:], count)
+
+		r := NewDeltaUint64ReaderCount(bytes.NewReader(corrupted), 64)
+		var err error
+		for err == nil {
+			_, err = r.ReadUint64()
+		}
+		if err == io.EOF {
+			t.Fatalf("count: %v, expected an error", count)
+		}
+	}
+}
+
+func TestDeltaUint64Reader_InvalidHeader(t *testing.T) {
+	for _, content := range [][]byte{nil, []byte("XSDV"), make([]byte, 100)} {
+		r := NewDeltaUint64ReaderCount(bytes.NewReader(content), 64)
+		if _, err := r.ReadUint64(); err != ErrInvalidDeltaHeader {
+			t.Fatalf("expected error: %v, actual: %v", ErrInvalidDeltaHeader, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package io
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+type KeyType int
+
+const (
+	// KeyBytes keys are compared lexicographically as unsigned bytes
+	KeyBytes KeyType = iota
+	// KeyUint64 keys are 8-byte unsigned integers in the byte order of the format
+	KeyUint64
+)
+
+// FixedRecordFormat describes fixed-width records, where the bytes [KeyOffset, KeyOffset+KeyLength)
+// are the sort key and the rest of the record is an opaque payload.
+// The records are read and written with BinaryReader and BinaryWriter using the codec returned by Codec.
+type FixedRecordFormat struct {
+	Size      int
+	KeyOffset int
+	KeyLength int
+	KeyType   KeyType
+	// ByteOrder of KeyUint64 keys. Little-endian if nil.
+	ByteOrder binary.ByteOrder
+}
+
+var ErrInvalidRecordFormat = errors.New("invalid record format")
+
+func (f FixedRecordFormat) Validate() error {
+	if f.Size < 1 || f.KeyOffset < 0 || f.KeyLength < 1 || f.KeyOffset+f.KeyLength > f.Size {
+		return ErrInvalidRecordFormat
+	}
+
+	if f.KeyType == KeyUint64 && f.KeyLength != SizeOfValue {
+		return ErrInvalidRecordFormat
+	}
+
+	return nil
+}
+
+func (f FixedRecordFormat) Codec() FixedBytesCodec {
+	return FixedBytesCodec{f.Size}
+}
+
+func (f FixedRecordFormat) Key(record []byte) []byte {
+	return record[f.KeyOffset : f.KeyOffset+f.KeyLength]
+}
+
+// KeyUint64 interprets the key of the record as an unsigned integer.
+func (f FixedRecordFormat) KeyUint64(record []byte) uint64 {
+	if f.ByteOrder == nil {
+		return binary.LittleEndian.Uint64(record[f.KeyOffset:])
+	}
+	return f.ByteOrder.Uint64(record[f.KeyOffset:])
+}
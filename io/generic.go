@@ -0,0 +1,418 @@
+package io
+
+import (
+	"fmt"
+	"github.com/xosmig/extsort/util"
+	"io"
+)
+
+// Writer is a generic counterpart of Uint64Writer.
+// All the writers of uint64 values in this package implement both interfaces.
+type Writer[T any] interface {
+	Write(x T) error
+	Flush() error
+	SetProfiler(p *util.SimpleProfiler)
+}
+
+func ReadTo[T any](r Reader[T], out *T, err *error) bool {
+	*out, *err = r.Read()
+	switch *err {
+	case nil:
+		return true
+	case io.EOF:
+		*err = nil
+		return false
+	default:
+		return false
+	}
+}
+
+func Copy[T any](r Reader[T], w Writer[T]) error {
+	var value T
+	var err error
+	for ReadTo(r, &value, &err) {
+		err = w.Write(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+type BinaryReader[T any] struct {
+	stream     io.Reader
+	codec      Codec[T]
+	valuesBuf  []T
+	valuesTail []T
+	readBuf    []byte
+	profiler   *util.SimpleProfiler
+}
+
+func NewBinaryReaderCountBuf[T any](r io.Reader, codec Codec[T], count int, bytesBuf []byte) *BinaryReader[T] {
+	if len(bytesBuf) < count*codec.Size() {
+		panic(ErrTooSmallBuffer)
+	}
+
+	valuesBuf := make([]T, count)
+	return &BinaryReader[T]{
+		stream:     r,
+		codec:      codec,
+		valuesBuf:  valuesBuf,
+		valuesTail: valuesBuf[:0],
+		readBuf:    bytesBuf[:count*codec.Size()],
+		profiler:   util.NewNilSimpleProfiler(),
+	}
+}
+
+func NewBinaryReaderCount[T any](r io.Reader, codec Codec[T], count int) *BinaryReader[T] {
+	return NewBinaryReaderCountBuf(r, codec, count, NewByteBuf(codec, count))
+}
+
+func NewBinaryReader[T any](r io.Reader, codec Codec[T]) *BinaryReader[T] {
+	return NewBinaryReaderCount(r, codec, DefaultBufValuesCount)
+}
+
+func (r *BinaryReader[T]) SetProfiler(p *util.SimpleProfiler) {
+	r.profiler = p
+}
+
+// either puts 1 or more new values to valuesTail or returns an error
+func (r *BinaryReader[T]) fillEmpty() error {
+	r.profiler.StartMeasuring()
+	n, err := io.ReadFull(r.stream, r.readBuf)
+	r.profiler.FinishMeasuring()
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+		if n == 0 {
+			return io.EOF
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	size := r.codec.Size()
+	if n%size != 0 {
+		return fmt.Errorf("expected to read number of bytes divisible by %v, read %v bytes", size, n)
+	}
+
+	count := n / size
+	for valueIdx := 0; valueIdx < count; valueIdx++ {
+		r.valuesBuf[valueIdx] = r.codec.Decode(r.readBuf[valueIdx*size:])
+	}
+
+	r.valuesTail = r.valuesBuf[:count]
+	return nil
+}
+
+func (r *BinaryReader[T]) Peek() (T, error) {
+	if len(r.valuesTail) == 0 {
+		err := r.fillEmpty()
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+	}
+
+	return r.valuesTail[0], nil
+}
+
+func (r *BinaryReader[T]) Read() (T, error) {
+	value, err := r.Peek()
+	if err != nil {
+		return value, err
+	}
+
+	r.valuesTail = r.valuesTail[1:]
+	return value, nil
+}
+
+type SliceReader[T any] struct {
+	data []T
+	pos  int
+}
+
+func NewSliceReader[T any](data []T) *SliceReader[T] {
+	return &SliceReader[T]{data, 0}
+}
+
+func (r *SliceReader[T]) SetProfiler(p *util.SimpleProfiler) {}
+
+func (r *SliceReader[T]) Read() (T, error) {
+	if r.pos == len(r.data) {
+		var zero T
+		return zero, io.EOF
+	}
+
+	value := r.data[r.pos]
+	r.pos++
+	return value, nil
+}
+
+func (r *SliceReader[T]) Data() []T {
+	return r.data[r.pos:]
+}
+
+type BoundedReader[T any] struct {
+	impl   Reader[T]
+	length uint64
+	read   uint64
+}
+
+func NewBoundedReader[T any](r Reader[T], length uint64) *BoundedReader[T] {
+	return &BoundedReader[T]{
+		impl:   r,
+		length: length,
+		read:   0,
+	}
+}
+
+func (r *BoundedReader[T]) SetProfiler(p *util.SimpleProfiler) {
+	r.impl.SetProfiler(p)
+}
+
+func (r *BoundedReader[T]) Read() (T, error) {
+	if r.read == r.length {
+		var zero T
+		return zero, io.EOF
+	}
+	r.read++
+	return r.impl.Read()
+}
+
+// ConcatReader is a generic counterpart of ConcatUint64Reader.
+type ConcatReader[T any] struct {
+	readers []Reader[T]
+}
+
+func NewConcatReader[T any](readers ...Reader[T]) *ConcatReader[T] {
+	return &ConcatReader[T]{readers: readers}
+}
+
+func (r *ConcatReader[T]) SetProfiler(p *util.SimpleProfiler) {
+	for _, reader := range r.readers {
+		reader.SetProfiler(p)
+	}
+}
+
+func (r *ConcatReader[T]) Read() (T, error) {
+	for len(r.readers) > 0 {
+		x, err := r.readers[0].Read()
+		if err != io.EOF {
+			return x, err
+		}
+		r.readers = r.readers[1:]
+	}
+	var zero T
+	return zero, io.EOF
+}
+
+// LazyReader is a generic counterpart of LazyUint64Reader.
+type LazyReader[T any] struct {
+	open     func() (Reader[T], io.Closer, error)
+	impl     Reader[T]
+	closer   io.Closer
+	profiler *util.SimpleProfiler
+	done     bool
+}
+
+func NewLazyReader[T any](open func() (Reader[T], io.Closer, error)) *LazyReader[T] {
+	return &LazyReader[T]{open: open}
+}
+
+func (r *LazyReader[T]) SetProfiler(p *util.SimpleProfiler) {
+	r.profiler = p
+	if r.impl != nil {
+		r.impl.SetProfiler(p)
+	}
+}
+
+func (r *LazyReader[T]) Read() (T, error) {
+	var zero T
+	if r.done {
+		return zero, io.EOF
+	}
+	if r.impl == nil {
+		impl, closer, err := r.open()
+		if err != nil {
+			return zero, err
+		}
+		r.impl, r.closer = impl, closer
+		if r.profiler != nil {
+			r.impl.SetProfiler(r.profiler)
+		}
+	}
+
+	x, err := r.impl.Read()
+	if err == io.EOF {
+		r.done = true
+		if closeErr := r.Close(); closeErr != nil {
+			return zero, closeErr
+		}
+	}
+	return x, err
+}
+
+func (r *LazyReader[T]) Close() error {
+	closer := r.closer
+	r.impl, r.closer = nil, nil
+	if closer == nil {
+		return nil
+	}
+	return closer.Close()
+}
+
+type BinaryWriter[T any] struct {
+	stream    WriteSyncer
+	codec     Codec[T]
+	valuesBuf []T
+	writeBuf  []byte
+	profiler  *util.SimpleProfiler
+}
+
+func NewBinaryWriterCountBuf[T any](w WriteSyncer, codec Codec[T], count int, byteBuffer []byte) *BinaryWriter[T] {
+	if len(byteBuffer) < count*codec.Size() {
+		panic(ErrTooSmallBuffer)
+	}
+
+	return &BinaryWriter[T]{
+		stream:    w,
+		codec:     codec,
+		valuesBuf: make([]T, 0, count),
+		writeBuf:  byteBuffer,
+		profiler:  util.NewNilSimpleProfiler(),
+	}
+}
+
+func NewBinaryWriterCount[T any](w WriteSyncer, codec Codec[T], count int) *BinaryWriter[T] {
+	return NewBinaryWriterCountBuf(w, codec, count, NewByteBuf(codec, count))
+}
+
+func NewBinaryWriter[T any](w WriteSyncer, codec Codec[T]) *BinaryWriter[T] {
+	return NewBinaryWriterCount(w, codec, DefaultBufValuesCount)
+}
+
+func (w *BinaryWriter[T]) SetProfiler(p *util.SimpleProfiler) {
+	w.profiler = p
+}
+
+// Flush writes the buffered values to the stream without syncing it (see BinaryUint64Writer.Flush).
+func (w *BinaryWriter[T]) Flush() error {
+	size := w.codec.Size()
+	count := len(w.valuesBuf)
+	for valueIdx := 0; valueIdx < count; valueIdx++ {
+		w.codec.Encode(w.writeBuf[valueIdx*size:], w.valuesBuf[valueIdx])
+	}
+
+	w.profiler.StartMeasuring()
+	_, err := w.stream.Write(w.writeBuf[:count*size])
+	w.profiler.FinishMeasuring()
+	if err != nil {
+		return err
+	}
+
+	w.valuesBuf = w.valuesBuf[:0]
+	return nil
+}
+
+func (w *BinaryWriter[T]) Write(x T) error {
+	if len(w.valuesBuf) == cap(w.valuesBuf) {
+		err := w.Flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	w.valuesBuf = append(w.valuesBuf, x)
+	return nil
+}
+
+type SliceWriter[T any] struct{ data []T }
+
+func NewSliceWriter[T any]() *SliceWriter[T] {
+	return new(SliceWriter[T])
+}
+
+func (w *SliceWriter[T]) Flush() error {
+	return nil
+}
+
+func (w *SliceWriter[T]) Write(x T) error {
+	w.data = append(w.data, x)
+	return nil
+}
+
+func (w *SliceWriter[T]) Data() []T {
+	return w.data
+}
+
+func (w *SliceWriter[T]) SetProfiler(p *util.SimpleProfiler) {}
+
+type uint64ReaderAdapter struct{ Uint64Reader }
+
+func (r uint64ReaderAdapter) Read() (uint64, error) {
+	return r.ReadUint64()
+}
+
+type readerAdapter struct{ Reader[uint64] }
+
+func (r readerAdapter) ReadUint64() (uint64, error) {
+	return r.Read()
+}
+
+type uint64WriterAdapter struct{ Uint64Writer }
+
+func (w uint64WriterAdapter) Write(x uint64) error {
+	return w.WriteUint64(x)
+}
+
+type writerAdapter struct{ Writer[uint64] }
+
+func (w writerAdapter) WriteUint64(x uint64) error {
+	return w.Write(x)
+}
+
+// AsReader returns r itself if it already implements Reader[uint64], otherwise it wraps r.
+func AsReader(r Uint64Reader) Reader[uint64] {
+	if generic, ok := r.(Reader[uint64]); ok {
+		return generic
+	}
+	return uint64ReaderAdapter{r}
+}
+
+// AsUint64Reader returns r itself if it already implements Uint64Reader, otherwise it wraps r.
+func AsUint64Reader(r Reader[uint64]) Uint64Reader {
+	if adapter, ok := r.(uint64ReaderAdapter); ok {
+		return adapter.Uint64Reader
+	}
+	if specialized, ok := r.(Uint64Reader); ok {
+		return specialized
+	}
+	return readerAdapter{r}
+}
+
+// AsWriter returns w itself if it already implements Writer[uint64], otherwise it wraps w.
+func AsWriter(w Uint64Writer) Writer[uint64] {
+	if generic, ok := w.(Writer[uint64]); ok {
+		return generic
+	}
+	return uint64WriterAdapter{w}
+}
+
+// AsUint64Writer returns w itself if it already implements Uint64Writer, otherwise it wraps w.
+func AsUint64Writer(w Writer[uint64]) Uint64Writer {
+	if adapter, ok := w.(uint64WriterAdapter); ok {
+		return adapter.Uint64Writer
+	}
+	if specialized, ok := w.(Uint64Writer); ok {
+		return specialized
+	}
+	return writerAdapter{w}
+}
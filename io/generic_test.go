@@ -0,0 +1,143 @@
+package io
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+var _ Reader[uint64] = new(BinaryUint64Reader)
+var _ Writer[uint64] = new(BinaryUint64Writer)
+var _ Reader[int64] = new(BinaryReader[int64])
+var _ Writer[int64] = new(BinaryWriter[int64])
+
+type testRecord struct {
+	key   int32
+	value uint16
+}
+
+type testRecordCodec struct{}
+
+func (testRecordCodec) Size() int { return 6 }
+
+func (testRecordCodec) Encode(buf []byte, x testRecord) {
+	binary.LittleEndian.PutUint32(buf, uint32(x.key))
+	binary.LittleEndian.PutUint16(buf[4:], x.value)
+}
+
+func (testRecordCodec) Decode(buf []byte) testRecord {
+	return testRecord{int32(binary.LittleEndian.Uint32(buf)), binary.LittleEndian.Uint16(buf[4:])}
+}
+
+func testBinaryWriteAndRead[T any](t *testing.T, codec Codec[T], data []T) {
+	f, disposeFile, err := createTmpFile()
+	defer disposeFile()
+	if err != nil {
+		t.Fatalf("createTmpFile: %v", err)
+	}
+
+	// use a small buffer to make sure that it is refilled several times
+	w := NewBinaryWriterCount(f, codec, 3)
+	err = Copy[T](NewSliceReader(data), w)
+	if err != nil {
+		t.Fatalf("error writing data: %v", err)
+	}
+
+	_, err = f.Seek(0, os.SEEK_SET)
+	if err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+
+	r := NewBinaryReaderCount(f, codec, 3)
+	output := NewSliceWriter[T]()
+	err = Copy[T](r, output)
+	if err != nil {
+		t.Fatalf("error reading data: %v", err)
+	}
+
+	if !reflect.DeepEqual(data, output.Data()) {
+		t.Fatalf("expected: %v, got: %v", data, output.Data())
+	}
+}
+
+func TestBinaryIO_WriteAndRead(t *testing.T) {
+	t.Run("int64", func(t *testing.T) {
+		testBinaryWriteAndRead[int64](t, Int64Codec{}, []int64{-5, 10, 0, -9223372036854775808, 42})
+	})
+	t.Run("float64", func(t *testing.T) {
+		testBinaryWriteAndRead[float64](t, Float64Codec{}, []float64{3.5, -1e100, 0, 2.25})
+	})
+	t.Run("bytes", func(t *testing.T) {
+		testBinaryWriteAndRead[[]byte](t, FixedBytesCodec{2}, [][]byte{[]byte("ab"), []byte("zz"), []byte("ba")})
+	})
+	t.Run("value_count", func(t *testing.T) {
+		testBinaryWriteAndRead[ValueCount](t, ValueCountCodec{}, []ValueCount{{5, 1}, {^uint64(0), 7}, {0, 1 << 40}})
+	})
+	t.Run("value_count_big_endian", func(t *testing.T) {
+		testBinaryWriteAndRead[ValueCount](t, ValueCountCodec{binary.BigEndian}, []ValueCount{{5, 1}, {1 << 63, 2}})
+	})
+	t.Run("struct", func(t *testing.T) {
+		testBinaryWriteAndRead[testRecord](t, testRecordCodec{}, []testRecord{{-1, 7}, {100, 0}, {5, 65535}, {0, 1}})
+	})
+}
+
+func TestAsUint64Reader_Adapters(t *testing.T) {
+	data := []uint64{3, 1, 2}
+
+	// a generic reader which does not implement Uint64Reader
+	r := AsUint64Reader(NewSliceReader(data))
+	w := NewSliceUint64Writer()
+	err := CopyValues(r, AsUint64Writer(AsWriter(w)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(data, w.Data()) {
+		t.Fatalf("expected: %v, got: %v", data, w.Data())
+	}
+}
+
+func TestConcatReader(t *testing.T) {
+	r := NewConcatReader[[]byte](
+		NewSliceReader([][]byte{[]byte("b"), []byte("a")}),
+		NewSliceReader[[]byte](nil),
+		NewSliceReader([][]byte{[]byte("c")}))
+	w := NewSliceWriter[[]byte]()
+	if err := Copy[[]byte](r, w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := [][]byte{[]byte("b"), []byte("a"), []byte("c")}
+	if !reflect.DeepEqual(expected, w.Data()) {
+		t.Fatalf("expected: %v, got: %v", expected, w.Data())
+	}
+}
+
+func TestLazyReader(t *testing.T) {
+	opened := 0
+	lazy := func(data ...string) Reader[string] {
+		return NewLazyReader(func() (Reader[string], io.Closer, error) {
+			opened++
+			return NewSliceReader(data), nil, nil
+		})
+	}
+
+	r := NewConcatReader(lazy("b", "a"), lazy(), lazy("c"))
+	if opened != 0 {
+		t.Fatalf("expected the inputs to be opened on the first read")
+	}
+	w := NewSliceWriter[string]()
+	if err := Copy[string](r, w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"b", "a", "c"}
+	if !reflect.DeepEqual(expected, w.Data()) {
+		t.Fatalf("expected: %v, got: %v", expected, w.Data())
+	}
+	if opened != 3 {
+		t.Fatalf("expected 3 inputs to be opened, got: %v", opened)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"github.com/xosmig/extsort/util"
 	"io"
+	"math/bits"
+	"strconv"
 )
 
 type Uint64Reader interface {
@@ -13,15 +15,30 @@ type Uint64Reader interface {
 	SetProfiler(p *util.SimpleProfiler)
 }
 
+// Reader is a generic counterpart of Uint64Reader.
+// All the readers of uint64 values in this package implement both interfaces.
+type Reader[T any] interface {
+	Read() (T, error)
+	SetProfiler(p *util.SimpleProfiler)
+}
+
 type BinaryUint64Reader struct {
 	stream     io.Reader
 	valuesBuf  []uint64
 	valuesTail []uint64
 	readBuf    []byte
+	swap       bool
 	profiler   *util.SimpleProfiler
 }
 
-func NewBinaryUint64ReaderCountBuf(r io.Reader, count int, bytesBuf []byte) *BinaryUint64Reader {
+// NewBinaryUint64ReaderCountBufOrder creates a reader of values in the given byte order.
+// The values in the native byte order (binary.NativeEndian) are read the fastest.
+func NewBinaryUint64ReaderCountBufOrder(
+	r io.Reader,
+	count int,
+	bytesBuf []byte,
+	order binary.ByteOrder) *BinaryUint64Reader {
+
 	if len(bytesBuf) < count*SizeOfValue {
 		panic(ErrTooSmallBuffer)
 	}
@@ -32,10 +49,16 @@ func NewBinaryUint64ReaderCountBuf(r io.Reader, count int, bytesBuf []byte) *Bin
 		valuesBuf:  valuesBuf,
 		valuesTail: valuesBuf[:0],
 		readBuf:    bytesBuf,
+		swap:       !isNativeOrder(order),
 		profiler:   util.NewNilSimpleProfiler(),
 	}
 }
 
+// NewBinaryUint64ReaderCountBuf creates a reader of little-endian values
+func NewBinaryUint64ReaderCountBuf(r io.Reader, count int, bytesBuf []byte) *BinaryUint64Reader {
+	return NewBinaryUint64ReaderCountBufOrder(r, count, bytesBuf, binary.LittleEndian)
+}
+
 func NewBinaryUint64ReaderCount(r io.Reader, count int) *BinaryUint64Reader {
 	return NewBinaryUint64ReaderCountBuf(r, count, NewUint64ByteBuf(count))
 }
@@ -71,7 +94,12 @@ func (r *BinaryUint64Reader) fillEmpty() error {
 
 	count := n / SizeOfValue
 	for valueIdx := 0; valueIdx < count; valueIdx++ {
-		r.valuesBuf[valueIdx] = binary.LittleEndian.Uint64(r.readBuf[valueIdx*SizeOfValue:])
+		r.valuesBuf[valueIdx] = binary.NativeEndian.Uint64(r.readBuf[valueIdx*SizeOfValue:])
+	}
+	if r.swap {
+		for valueIdx := 0; valueIdx < count; valueIdx++ {
+			r.valuesBuf[valueIdx] = bits.ReverseBytes64(r.valuesBuf[valueIdx])
+		}
 	}
 
 	r.valuesTail = r.valuesBuf[:count]
@@ -99,6 +127,10 @@ func (r *BinaryUint64Reader) ReadUint64() (uint64, error) {
 	return value, nil
 }
 
+func (r *BinaryUint64Reader) Read() (uint64, error) {
+	return r.ReadUint64()
+}
+
 type SliceUint64Reader struct {
 	data []uint64
 	pos  int
@@ -120,6 +152,10 @@ func (r *SliceUint64Reader) ReadUint64() (uint64, error) {
 	return value, nil
 }
 
+func (r *SliceUint64Reader) Read() (uint64, error) {
+	return r.ReadUint64()
+}
+
 func (r *SliceUint64Reader) Data() []uint64 {
 	return r.data[r.pos:]
 }
@@ -163,20 +199,157 @@ func (r *BoundedUint64Reader) ReadUint64() (uint64, error) {
 	return r.impl.ReadUint64()
 }
 
-type TextUint64Reader struct {
-	stream   *bufio.Reader
+func (r *BoundedUint64Reader) Read() (uint64, error) {
+	return r.ReadUint64()
+}
+
+// ConcatUint64Reader reads the values of the readers one after another.
+// Unlike io.MultiReader, it concatenates the values rather than the bytes, so that the inputs do not need
+// a trailing delimiter and may have headers (see DeltaUint64Reader).
+type ConcatUint64Reader struct {
+	readers []Uint64Reader
+}
+
+func NewConcatUint64Reader(readers ...Uint64Reader) *ConcatUint64Reader {
+	return &ConcatUint64Reader{readers: readers}
+}
+
+func (r *ConcatUint64Reader) SetProfiler(p *util.SimpleProfiler) {
+	for _, reader := range r.readers {
+		reader.SetProfiler(p)
+	}
+}
+
+func (r *ConcatUint64Reader) ReadUint64() (uint64, error) {
+	for len(r.readers) > 0 {
+		x, err := r.readers[0].ReadUint64()
+		if err != io.EOF {
+			return x, err
+		}
+		r.readers = r.readers[1:]
+	}
+	return 0, io.EOF
+}
+
+func (r *ConcatUint64Reader) Read() (uint64, error) {
+	return r.ReadUint64()
+}
+
+// LazyUint64Reader opens the underlying reader on the first read and closes it at the end of the input.
+// A lot of inputs can be read one after another (see ConcatUint64Reader) or a few at a time this way,
+// without keeping all of them open and allocating all of their buffers at once.
+type LazyUint64Reader struct {
+	open     func() (Uint64Reader, io.Closer, error)
+	impl     Uint64Reader
+	closer   io.Closer
 	profiler *util.SimpleProfiler
+	done     bool
+}
+
+// NewLazyUint64Reader creates a reader, which calls open on the first read. The closer returned by open may be nil.
+func NewLazyUint64Reader(open func() (Uint64Reader, io.Closer, error)) *LazyUint64Reader {
+	return &LazyUint64Reader{open: open}
+}
+
+func (r *LazyUint64Reader) SetProfiler(p *util.SimpleProfiler) {
+	r.profiler = p
+	if r.impl != nil {
+		r.impl.SetProfiler(p)
+	}
 }
 
+func (r *LazyUint64Reader) ReadUint64() (uint64, error) {
+	if r.done {
+		return 0, io.EOF
+	}
+	if r.impl == nil {
+		impl, closer, err := r.open()
+		if err != nil {
+			return 0, err
+		}
+		r.impl, r.closer = impl, closer
+		if r.profiler != nil {
+			r.impl.SetProfiler(r.profiler)
+		}
+	}
+
+	x, err := r.impl.ReadUint64()
+	if err == io.EOF {
+		r.done = true
+		if closeErr := r.Close(); closeErr != nil {
+			return 0, closeErr
+		}
+	}
+	return x, err
+}
+
+func (r *LazyUint64Reader) Read() (uint64, error) {
+	return r.ReadUint64()
+}
+
+// Close closes the underlying reader if it is open. It is called automatically at the end of the input.
+func (r *LazyUint64Reader) Close() error {
+	closer := r.closer
+	r.impl, r.closer = nil, nil
+	if closer == nil {
+		return nil
+	}
+	return closer.Close()
+}
+
+// maxTokenLength limits the length of a token reported by TextParseError
+const maxTokenLength = 64
+
+// TextParseError is returned by TextUint64Reader if a token of the input is not a valid number.
+// Err is strconv.ErrSyntax or strconv.ErrRange.
+type TextParseError struct {
+	Line  int
+	Token string
+	Err   error
+}
+
+func (e *TextParseError) Error() string {
+	return fmt.Sprintf("line %v: cannot parse %q: %v", e.Line, e.Token, e.Err)
+}
+
+func (e *TextParseError) Unwrap() error {
+	return e.Err
+}
+
+// TextUint64Reader reads numbers in the given text format (see TextFormat)
+type TextUint64Reader struct {
+	stream     *bufio.Reader
+	profiler   *util.SimpleProfiler
+	separators *[256]bool
+	strict     bool
+	parser     numberParser
+	line       int
+	token      []byte
+}
+
+// NewTextUint64ReaderCount creates a reader of whitespace-separated decimal numbers
 func NewTextUint64ReaderCount(r io.Reader, count int) *TextUint64Reader {
+	return NewTextUint64ReaderCountFormat(r, count, DefaultTextFormat())
+}
+
+func NewTextUint64ReaderCountFormat(r io.Reader, count int, format TextFormat) *TextUint64Reader {
+	if err := format.Validate(); err != nil {
+		panic(err)
+	}
+
 	stream, ok := r.(*bufio.Reader)
 	if !ok {
 		stream = bufio.NewReaderSize(r, count*SizeOfValue)
 	}
 
 	return &TextUint64Reader{
-		stream:   stream,
-		profiler: util.NewNilSimpleProfiler(),
+		stream:     stream,
+		profiler:   util.NewNilSimpleProfiler(),
+		separators: format.separators(),
+		strict:     format.Strict,
+		parser:     newNumberParser(format),
+		line:       1,
+		token:      make([]byte, 0, maxTokenLength),
 	}
 }
 
@@ -184,64 +357,98 @@ func (r *TextUint64Reader) SetProfiler(p *util.SimpleProfiler) {
 	r.profiler = p
 }
 
-func (r *TextUint64Reader) ReadUint64() (uint64, error) {
-	var value uint64
-	r.profiler.StartMeasuring()
-	_, err := fmt.Fscanf(r.stream, "%d", &value)
-	r.profiler.FinishMeasuring()
+// skipSeparators returns the first byte after the separators
+func (r *TextUint64Reader) skipSeparators() (byte, error) {
+	for {
+		b, err := r.stream.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if !r.separators[b] {
+			return b, nil
+		}
+		if b == '\n' {
+			r.line++
+		}
+	}
+}
+
+func (r *TextUint64Reader) appendToken(bytes []byte) {
+	if free := maxTokenLength - len(r.token); len(bytes) > free {
+		bytes = bytes[:free]
+	}
+	r.token = append(r.token, bytes...)
+}
+
+func (r *TextUint64Reader) parseUint64() (uint64, error) {
+	var first byte
+	var err error
+	if r.strict {
+		first, err = r.stream.ReadByte()
+	} else {
+		first, err = r.skipSeparators()
+	}
 	if err != nil {
 		return 0, err
 	}
+
+	line := r.line
+	r.parser.reset()
+	r.token = r.token[:0]
+	if r.separators[first] {
+		// a separator right after the previous one is an empty value in the strict mode
+		if first == '\n' {
+			r.line++
+		}
+		return 0, &TextParseError{Line: line, Token: "", Err: strconv.ErrSyntax}
+	}
+	r.parser.add(first)
+	r.token = append(r.token, first)
+
+	// the token is parsed right in the buffer of the reader, which is refilled if the token crosses its end
+	for {
+		if _, err := r.stream.Peek(1); err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+
+		buf, _ := r.stream.Peek(r.stream.Buffered())
+		length := 0
+		for length < len(buf) && !r.separators[buf[length]] {
+			r.parser.add(buf[length])
+			length++
+		}
+		r.appendToken(buf[:length])
+
+		if length < len(buf) {
+			if buf[length] == '\n' {
+				r.line++
+			}
+			// skip the separator as well
+			r.stream.Discard(length + 1)
+			break
+		}
+		r.stream.Discard(length)
+	}
+
+	value, err := r.parser.finish()
+	if err != nil {
+		return 0, &TextParseError{Line: line, Token: string(r.token), Err: err}
+	}
 	return value, nil
 }
 
-//func isDigit(b byte) bool {
-//	return b >= '0' && b <= '9'
-//}
-//
-//func atoi(buf []byte) (uint64, []byte) {
-//	var res uint64 = 0
-//
-//	for len(buf) > 0 && isDigit(buf[0]) {
-//		res = 10 * res + uint64(buf[0] - '0')
-//		buf = buf[1:]
-//	}
-//
-//	return res, buf
-//}
-//
-//func (r *TextUint64Reader) ReadUint64() (uint64, error) {
-//	byteBuf := make([]byte, 0, 30)
-//
-//	r.profiler.StartMeasuring()
-//	var err error
-//	for {
-//		var b byte
-//		b, err = r.stream.ReadByte()
-//		if err != nil {
-//			break
-//		}
-//		if !isDigit(b) {
-//			r.stream.UnreadByte()
-//			break
-//		}
-//		byteBuf = append(byteBuf, b)
-//	}
-//	r.profiler.FinishMeasuring()
-//
-//	if err != nil && err != io.EOF {
-//		return 0, err
-//	}
-//
-//	if len(byteBuf) == nil
-//
-//	value, tail := atoi(byteBuf[:readBytes])
-//	for idx := len(tail) - 1; idx >= 0; idx-- {
-//		r.stream.UnreadByte()
-//	}
-//
-//	return value, nil
-//}
+func (r *TextUint64Reader) ReadUint64() (uint64, error) {
+	r.profiler.StartMeasuring()
+	value, err := r.parseUint64()
+	r.profiler.FinishMeasuring()
+	return value, err
+}
+
+func (r *TextUint64Reader) Read() (uint64, error) {
+	return r.ReadUint64()
+}
 
 //func (r BoundedUint64Reader) PeekUint64() (uint64, error) {
 //	if r.read == r.length {
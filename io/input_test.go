@@ -1,8 +1,11 @@
 package io
 
 import (
+	"errors"
 	"io"
 	"log"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -83,3 +86,84 @@ func TestBinaryUint64Reader_EOF(t *testing.T) {
 		}
 	}
 }
+
+func TestConcatUint64Reader(t *testing.T) {
+	// the first text input has no trailing delimiter, which must not join its last value with the next input
+	r := NewConcatUint64Reader(
+		NewTextUint64ReaderCount(strings.NewReader("1 2"), 1),
+		NewSliceUint64Reader(nil),
+		NewTextUint64ReaderCount(strings.NewReader("3\n4\n"), 1),
+		NewSliceUint64Reader([]uint64{5}))
+	w := NewSliceUint64Writer()
+	if err := CopyValues(r, w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []uint64{1, 2, 3, 4, 5}
+	if !reflect.DeepEqual(expected, w.Data()) {
+		t.Fatalf("expected: %v, got: %v", expected, w.Data())
+	}
+	if _, err := r.ReadUint64(); err != io.EOF {
+		t.Fatalf("expected EOF, got: %v", err)
+	}
+}
+
+func TestConcatUint64Reader_Error(t *testing.T) {
+	r := NewConcatUint64Reader(
+		NewSliceUint64Reader([]uint64{1}),
+		NewTextUint64ReaderCount(strings.NewReader("x"), 1),
+		NewSliceUint64Reader([]uint64{2}))
+	if x, err := r.ReadUint64(); err != nil || x != 1 {
+		t.Fatalf("expected 1, got: %v, %v", x, err)
+	}
+	if _, err := r.ReadUint64(); err == nil || err == io.EOF {
+		t.Fatalf("expected a parse error, got: %v", err)
+	}
+}
+
+// openCounter counts the inputs, which are open at the same time
+type openCounter struct {
+	open *int
+}
+
+func (c openCounter) Close() error {
+	*c.open--
+	return nil
+}
+
+func TestLazyUint64Reader(t *testing.T) {
+	open, maxOpen := 0, 0
+	lazy := func(text string) Uint64Reader {
+		return NewLazyUint64Reader(func() (Uint64Reader, io.Closer, error) {
+			open++
+			if open > maxOpen {
+				maxOpen = open
+			}
+			return NewTextUint64ReaderCount(strings.NewReader(text), 1), openCounter{&open}, nil
+		})
+	}
+
+	r := NewConcatUint64Reader(lazy("1 2"), lazy(""), lazy("3"))
+	w := NewSliceUint64Writer()
+	if err := CopyValues(r, w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []uint64{1, 2, 3}
+	if !reflect.DeepEqual(expected, w.Data()) {
+		t.Fatalf("expected: %v, got: %v", expected, w.Data())
+	}
+	if open != 0 || maxOpen != 1 {
+		t.Fatalf("expected the inputs to be open one at a time, open: %v, max open: %v", open, maxOpen)
+	}
+}
+
+func TestLazyUint64Reader_OpenError(t *testing.T) {
+	openErr := errors.New("open error")
+	r := NewLazyUint64Reader(func() (Uint64Reader, io.Closer, error) {
+		return nil, nil, openErr
+	})
+	if _, err := r.ReadUint64(); err != openErr {
+		t.Fatalf("expected error: %v, got: %v", openErr, err)
+	}
+}
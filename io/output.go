@@ -6,6 +6,7 @@ import (
 	"errors"
 	"github.com/xosmig/extsort/util"
 	"io"
+	"math/bits"
 	"strconv"
 )
 
@@ -28,12 +29,20 @@ type BinaryUint64Writer struct {
 	stream    WriteSyncer
 	valuesBuf []uint64
 	writeBuf  []byte
+	swap      bool
 	profiler  *util.SimpleProfiler
 }
 
 var ErrTooSmallBuffer = errors.New("too small buffer provided")
 
-func NewBinaryUint64WriterCountBuf(w WriteSyncer, count int, byteBuffer []byte) *BinaryUint64Writer {
+// NewBinaryUint64WriterCountBufOrder creates a writer of values in the given byte order.
+// The values in the native byte order (binary.NativeEndian) are written the fastest.
+func NewBinaryUint64WriterCountBufOrder(
+	w WriteSyncer,
+	count int,
+	byteBuffer []byte,
+	order binary.ByteOrder) *BinaryUint64Writer {
+
 	if len(byteBuffer) < count*SizeOfValue {
 		panic(ErrTooSmallBuffer)
 	}
@@ -42,10 +51,16 @@ func NewBinaryUint64WriterCountBuf(w WriteSyncer, count int, byteBuffer []byte)
 		stream:    w,
 		valuesBuf: make([]uint64, 0, count),
 		writeBuf:  byteBuffer,
+		swap:      !isNativeOrder(order),
 		profiler:  util.NewNilSimpleProfiler(),
 	}
 }
 
+// NewBinaryUint64WriterCountBuf creates a writer of little-endian values
+func NewBinaryUint64WriterCountBuf(w WriteSyncer, count int, byteBuffer []byte) *BinaryUint64Writer {
+	return NewBinaryUint64WriterCountBufOrder(w, count, byteBuffer, binary.LittleEndian)
+}
+
 func NewBinaryUint64WriterCount(w WriteSyncer, count int) *BinaryUint64Writer {
 	return NewBinaryUint64WriterCountBuf(w, count, NewUint64ByteBuf(count))
 }
@@ -58,28 +73,25 @@ func (w *BinaryUint64Writer) SetProfiler(p *util.SimpleProfiler) {
 	w.profiler = p
 }
 
+// Flush writes the buffered values to the stream. The stream is not synced, since an fsync per buffer is slow
+// and not needed for the temporary files. Wrap the stream with SyncWriter to sync it according to a SyncPolicy.
 func (w *BinaryUint64Writer) Flush() error {
 	count := len(w.valuesBuf)
-	for valueIdx := 0; valueIdx < count; valueIdx++ {
-		binary.LittleEndian.PutUint64(w.writeBuf[valueIdx*SizeOfValue:], w.valuesBuf[valueIdx])
+	if w.swap {
+		for valueIdx := 0; valueIdx < count; valueIdx++ {
+			binary.NativeEndian.PutUint64(w.writeBuf[valueIdx*SizeOfValue:], bits.ReverseBytes64(w.valuesBuf[valueIdx]))
+		}
+	} else {
+		for valueIdx := 0; valueIdx < count; valueIdx++ {
+			binary.NativeEndian.PutUint64(w.writeBuf[valueIdx*SizeOfValue:], w.valuesBuf[valueIdx])
+		}
 	}
 
-	var errWrite error = nil
-	var errSync error = nil
-
 	w.profiler.StartMeasuring()
-	_, errWrite = w.stream.Write(w.writeBuf[:count*SizeOfValue])
-	if errWrite == nil {
-		errSync = w.stream.Sync()
-	}
+	_, err := w.stream.Write(w.writeBuf[:count*SizeOfValue])
 	w.profiler.FinishMeasuring()
-
-	if errWrite != nil {
-		return errWrite
-	}
-
-	if errSync != nil {
-		return errSync
+	if err != nil {
+		return err
 	}
 
 	w.valuesBuf = w.valuesBuf[:0]
@@ -98,6 +110,10 @@ func (w *BinaryUint64Writer) WriteUint64(x uint64) error {
 	return nil
 }
 
+func (w *BinaryUint64Writer) Write(x uint64) error {
+	return w.WriteUint64(x)
+}
+
 type SliceUint64Writer struct{ data []uint64 }
 
 func NewSliceUint64Writer() *SliceUint64Writer {
@@ -113,6 +129,10 @@ func (w *SliceUint64Writer) WriteUint64(x uint64) error {
 	return nil
 }
 
+func (w *SliceUint64Writer) Write(x uint64) error {
+	return w.WriteUint64(x)
+}
+
 func (w *SliceUint64Writer) Data() []uint64 {
 	_, _ = util.NewSharedBufHeap(100)
 	return w.data
@@ -134,14 +154,29 @@ func (w NullUint64Writer) WriteUint64(x uint64) error {
 	return nil
 }
 
+func (w NullUint64Writer) Write(x uint64) error {
+	return nil
+}
+
 func (w NullUint64Writer) SetProfiler(p *util.SimpleProfiler) {}
 
+// TextUint64Writer writes numbers in the given text format (see TextFormat)
 type TextUint64Writer struct {
 	stream   *bufio.Writer
+	format   TextFormat
 	profiler *util.SimpleProfiler
 }
 
+// NewTextUint64WriterCount creates a writer of decimal numbers, one per line
 func NewTextUint64WriterCount(w io.Writer, count int) *TextUint64Writer {
+	return NewTextUint64WriterCountFormat(w, count, DefaultTextFormat())
+}
+
+func NewTextUint64WriterCountFormat(w io.Writer, count int, format TextFormat) *TextUint64Writer {
+	if err := format.Validate(); err != nil {
+		panic(err)
+	}
+
 	stream, ok := w.(*bufio.Writer)
 	if !ok {
 		stream = bufio.NewWriterSize(w, count*SizeOfValue)
@@ -149,6 +184,7 @@ func NewTextUint64WriterCount(w io.Writer, count int) *TextUint64Writer {
 
 	return &TextUint64Writer{
 		stream:   stream,
+		format:   format,
 		profiler: util.NewNilSimpleProfiler(),
 	}
 }
@@ -158,15 +194,54 @@ func (w *TextUint64Writer) SetProfiler(p *util.SimpleProfiler) {
 }
 
 func (w *TextUint64Writer) WriteUint64(x uint64) error {
-	byteBuf := make([]byte, 0, 30)
-	bufWithValue := strconv.AppendUint(byteBuf, x /*base=*/, 10)
-
 	w.profiler.StartMeasuring()
-	_, err := w.stream.Write(bufWithValue)
+	// the value is formatted right into the free space of the buffer, so that nothing is allocated or copied
+	_, err := w.stream.Write(w.format.appendValue(w.stream.AvailableBuffer(), x))
 	w.profiler.FinishMeasuring()
 	return err
 }
 
+func (w *TextUint64Writer) Write(x uint64) error {
+	return w.WriteUint64(x)
+}
+
 func (w *TextUint64Writer) Flush() error {
 	return w.stream.Flush()
 }
+
+// TextValueCountWriter writes every value in the given text format followed by a space and its count.
+// The count is always a decimal number.
+type TextValueCountWriter struct {
+	stream   *bufio.Writer
+	format   TextFormat
+	profiler *util.SimpleProfiler
+}
+
+func NewTextValueCountWriterCountFormat(w io.Writer, count int, format TextFormat) *TextValueCountWriter {
+	if err := format.Validate(); err != nil {
+		panic(err)
+	}
+
+	return &TextValueCountWriter{
+		stream:   bufio.NewWriterSize(w, count*SizeOfValue),
+		format:   format,
+		profiler: util.NewNilSimpleProfiler(),
+	}
+}
+
+func (w *TextValueCountWriter) SetProfiler(p *util.SimpleProfiler) {
+	w.profiler = p
+}
+
+func (w *TextValueCountWriter) Write(x ValueCount) error {
+	w.profiler.StartMeasuring()
+	buf := append(w.format.AppendNumber(w.stream.AvailableBuffer(), x.Value), ' ')
+	buf = append(strconv.AppendUint(buf, x.Count, 10), w.format.Delimiter)
+	_, err := w.stream.Write(buf)
+	w.profiler.FinishMeasuring()
+	return err
+}
+
+func (w *TextValueCountWriter) Flush() error {
+	return w.stream.Flush()
+}
@@ -0,0 +1,169 @@
+package io
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/xosmig/extsort/util"
+	"io"
+)
+
+// Variable-length records are stored as the uvarint-encoded record length followed by the record bytes.
+
+// RecordEncodedSize returns the number of bytes occupied by the record in the length-prefixed format.
+func RecordEncodedSize(record []byte) int {
+	var lengthBuf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(lengthBuf[:], uint64(len(record))) + len(record)
+}
+
+type RecordReader struct {
+	stream   *bufio.Reader
+	profiler *util.SimpleProfiler
+}
+
+func NewRecordReaderSize(r io.Reader, size int) *RecordReader {
+	return &RecordReader{
+		stream:   bufio.NewReaderSize(r, size),
+		profiler: util.NewNilSimpleProfiler(),
+	}
+}
+
+func (r *RecordReader) SetProfiler(p *util.SimpleProfiler) {
+	r.profiler = p
+}
+
+// Read returns a newly allocated record, so the caller may retain it.
+func (r *RecordReader) Read() ([]byte, error) {
+	r.profiler.StartMeasuring()
+	defer r.profiler.FinishMeasuring()
+
+	length, err := binary.ReadUvarint(r.stream)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, length)
+	_, err = io.ReadFull(r.stream, record)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading record of length %v: %v", length, err)
+	}
+
+	return record, nil
+}
+
+type RecordWriter struct {
+	stream    *bufio.Writer
+	lengthBuf [binary.MaxVarintLen64]byte
+	profiler  *util.SimpleProfiler
+}
+
+func NewRecordWriterSize(w WriteSyncer, size int) *RecordWriter {
+	return &RecordWriter{
+		stream:   bufio.NewWriterSize(w, size),
+		profiler: util.NewNilSimpleProfiler(),
+	}
+}
+
+func (w *RecordWriter) SetProfiler(p *util.SimpleProfiler) {
+	w.profiler = p
+}
+
+func (w *RecordWriter) Write(record []byte) error {
+	n := binary.PutUvarint(w.lengthBuf[:], uint64(len(record)))
+
+	w.profiler.StartMeasuring()
+	defer w.profiler.FinishMeasuring()
+
+	_, err := w.stream.Write(w.lengthBuf[:n])
+	if err != nil {
+		return err
+	}
+	_, err = w.stream.Write(record)
+	return err
+}
+
+// Flush writes the buffered records to the stream without syncing it (see BinaryUint64Writer.Flush).
+func (w *RecordWriter) Flush() error {
+	w.profiler.StartMeasuring()
+	defer w.profiler.FinishMeasuring()
+
+	return w.stream.Flush()
+}
+
+// LineReader reads newline-delimited records. The trailing newline is not included in the records.
+type LineReader struct {
+	stream   *bufio.Reader
+	profiler *util.SimpleProfiler
+}
+
+func NewLineReaderSize(r io.Reader, size int) *LineReader {
+	stream, ok := r.(*bufio.Reader)
+	if !ok {
+		stream = bufio.NewReaderSize(r, size)
+	}
+
+	return &LineReader{
+		stream:   stream,
+		profiler: util.NewNilSimpleProfiler(),
+	}
+}
+
+func (r *LineReader) SetProfiler(p *util.SimpleProfiler) {
+	r.profiler = p
+}
+
+// Read returns a newly allocated line, so the caller may retain it.
+func (r *LineReader) Read() ([]byte, error) {
+	r.profiler.StartMeasuring()
+	line, err := r.stream.ReadBytes('\n')
+	r.profiler.FinishMeasuring()
+
+	if err == io.EOF && len(line) > 0 {
+		// the last line is not terminated with a newline
+		return line, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return line[:len(line)-1], nil
+}
+
+type LineWriter struct {
+	stream   *bufio.Writer
+	profiler *util.SimpleProfiler
+}
+
+func NewLineWriterSize(w io.Writer, size int) *LineWriter {
+	stream, ok := w.(*bufio.Writer)
+	if !ok {
+		stream = bufio.NewWriterSize(w, size)
+	}
+
+	return &LineWriter{
+		stream:   stream,
+		profiler: util.NewNilSimpleProfiler(),
+	}
+}
+
+func (w *LineWriter) SetProfiler(p *util.SimpleProfiler) {
+	w.profiler = p
+}
+
+func (w *LineWriter) Write(line []byte) error {
+	w.profiler.StartMeasuring()
+	defer w.profiler.FinishMeasuring()
+
+	_, err := w.stream.Write(line)
+	if err != nil {
+		return err
+	}
+	return w.stream.WriteByte('\n')
+}
+
+func (w *LineWriter) Flush() error {
+	return w.stream.Flush()
+}
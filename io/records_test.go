@@ -0,0 +1,82 @@
+package io
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var _ Reader[[]byte] = new(RecordReader)
+var _ Writer[[]byte] = new(RecordWriter)
+var _ Reader[[]byte] = new(LineReader)
+var _ Writer[[]byte] = new(LineWriter)
+
+func TestRecordIO_WriteAndRead(t *testing.T) {
+	f, disposeFile, err := createTmpFile()
+	defer disposeFile()
+	if err != nil {
+		t.Fatalf("createTmpFile: %v", err)
+	}
+
+	data := [][]byte{[]byte("hello"), {}, bytes.Repeat([]byte("x"), 300), []byte("world\n")}
+
+	w := NewRecordWriterSize(f, 16)
+	err = Copy[[]byte](NewSliceReader(data), w)
+	if err != nil {
+		t.Fatalf("error writing data: %v", err)
+	}
+
+	expectedSize := 0
+	for _, record := range data {
+		expectedSize += RecordEncodedSize(record)
+	}
+	offset, err := f.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	if offset != int64(expectedSize) {
+		t.Errorf("expected %v bytes to be written, actual: %v", expectedSize, offset)
+	}
+
+	_, err = f.Seek(0, os.SEEK_SET)
+	if err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+
+	output := NewSliceWriter[[]byte]()
+	err = Copy[[]byte](NewRecordReaderSize(f, 16), output)
+	if err != nil {
+		t.Fatalf("error reading data: %v", err)
+	}
+
+	if !reflect.DeepEqual(data, output.Data()) {
+		t.Fatalf("expected: %q, got: %q", data, output.Data())
+	}
+}
+
+func TestLineIO(t *testing.T) {
+	input := "b\n\na c\nlast line without newline"
+	expectedLines := [][]byte{[]byte("b"), {}, []byte("a c"), []byte("last line without newline")}
+
+	lines := NewSliceWriter[[]byte]()
+	err := Copy[[]byte](NewLineReaderSize(strings.NewReader(input), 16), lines)
+	if err != nil {
+		t.Fatalf("error reading lines: %v", err)
+	}
+
+	if !reflect.DeepEqual(expectedLines, lines.Data()) {
+		t.Fatalf("expected: %q, got: %q", expectedLines, lines.Data())
+	}
+
+	var output bytes.Buffer
+	err = Copy[[]byte](NewSliceReader(lines.Data()), NewLineWriterSize(&output, 16))
+	if err != nil {
+		t.Fatalf("error writing lines: %v", err)
+	}
+
+	if output.String() != input+"\n" {
+		t.Fatalf("expected: %q, got: %q", input+"\n", output.String())
+	}
+}
@@ -0,0 +1,127 @@
+package io
+
+import (
+	"errors"
+	"io"
+	"syscall"
+)
+
+type SyncMode int
+
+const (
+	// SyncNever does not sync the data. It is enough for the files, which are not needed after a crash.
+	SyncNever SyncMode = iota
+	// SyncOnClose syncs the data once, when the writer is closed
+	SyncOnClose
+	// SyncEveryBytes syncs the data after every SyncPolicy.Bytes bytes and when the writer is closed
+	SyncEveryBytes
+	// SyncEveryFlush syncs the data every time a writer of values flushes its buffer to the SyncWriter,
+	// that is after every Write
+	SyncEveryFlush
+)
+
+// SyncPolicy defines when the data written by SyncWriter is synced to the disk
+type SyncPolicy struct {
+	Mode SyncMode
+	// Bytes is only used by SyncEveryBytes
+	Bytes int64
+}
+
+var ErrInvalidSyncPolicy = errors.New("invalid sync policy")
+
+func (p SyncPolicy) Validate() error {
+	if p.Mode < SyncNever || p.Mode > SyncEveryFlush || (p.Mode == SyncEveryBytes && p.Bytes < 1) {
+		return ErrInvalidSyncPolicy
+	}
+	return nil
+}
+
+// SyncWriter syncs the underlying writer according to the policy.
+// The writers of values never sync their streams themselves, so a stream of a writer has to be wrapped
+// with SyncWriter to be synced.
+type SyncWriter struct {
+	stream   WriteSyncer
+	policy   SyncPolicy
+	unsynced int64
+	closed   bool
+}
+
+func NewSyncWriter(w WriteSyncer, policy SyncPolicy) *SyncWriter {
+	if err := policy.Validate(); err != nil {
+		panic(err)
+	}
+
+	return &SyncWriter{
+		stream: w,
+		policy: policy,
+	}
+}
+
+func (w *SyncWriter) sync() error {
+	w.unsynced = 0
+	err := w.stream.Sync()
+	// pipes and terminals cannot be synced, and there is nothing to sync
+	if errors.Is(err, syscall.EINVAL) {
+		return nil
+	}
+	return err
+}
+
+func (w *SyncWriter) Write(p []byte) (int, error) {
+	n, err := w.stream.Write(p)
+	w.unsynced += int64(n)
+	if err != nil {
+		return n, err
+	}
+
+	switch {
+	case w.policy.Mode == SyncEveryFlush && n > 0:
+		return n, w.sync()
+	case w.policy.Mode == SyncEveryBytes && w.unsynced >= w.policy.Bytes:
+		return n, w.sync()
+	}
+	return n, nil
+}
+
+// Sync syncs the data written since the last sync unless the policy is SyncNever
+func (w *SyncWriter) Sync() error {
+	if w.policy.Mode == SyncNever || w.unsynced == 0 {
+		return nil
+	}
+	return w.sync()
+}
+
+// Seek seeks the underlying writer if it is an io.Seeker
+func (w *SyncWriter) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := w.stream.(io.Seeker)
+	if !ok {
+		return 0, errors.New("the underlying writer cannot seek")
+	}
+	return seeker.Seek(offset, whence)
+}
+
+// WriteAt writes to the underlying writer at the offset if it is an io.WriterAt.
+// The data is synced along with the data written by Write.
+func (w *SyncWriter) WriteAt(p []byte, offset int64) (int, error) {
+	writerAt, ok := w.stream.(io.WriterAt)
+	if !ok {
+		return 0, errors.New("the underlying writer cannot write at an offset")
+	}
+	n, err := writerAt.WriteAt(p, offset)
+	w.unsynced += int64(n)
+	return n, err
+}
+
+// Close syncs the data written since the last sync unless the policy is SyncNever.
+// It does not close the underlying writer.
+func (w *SyncWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if w.policy.Mode == SyncNever || w.unsynced == 0 {
+		return nil
+	}
+	return w.sync()
+}
@@ -0,0 +1,130 @@
+package io
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSyncWriter_Policies(t *testing.T) {
+	testCases := []struct {
+		name  string
+		mode  SyncMode
+		bytes int64
+		// the expected number of syncs after writing and flushing 10 blocks of 8 values and closing the writer
+		syncs int
+	}{
+		{"never", SyncNever, 0, 0},
+		{"on_close", SyncOnClose, 0, 1},
+		{"every_bytes", SyncEveryBytes, 200, 2 + 1},
+		{"every_bytes_exact", SyncEveryBytes, 320, 2},
+		{"every_flush", SyncEveryFlush, 0, 10},
+	}
+
+	for _, tc := range testCases {
+		var buf bufferSyncer
+		sw := NewSyncWriter(&buf, SyncPolicy{tc.mode, tc.bytes})
+		w := NewBinaryUint64WriterCount(sw, 8)
+		for i := 0; i < 80; i++ {
+			if err := w.WriteUint64(uint64(i)); err != nil {
+				t.Fatalf("%v: unexpected error: %v", tc.name, err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("%v: unexpected error: %v", tc.name, err)
+		}
+		if err := sw.Close(); err != nil {
+			t.Fatalf("%v: unexpected error: %v", tc.name, err)
+		}
+
+		if buf.syncs != tc.syncs {
+			t.Fatalf("%v: expected %v syncs, actual: %v", tc.name, tc.syncs, buf.syncs)
+		}
+		if buf.Len() != 80*SizeOfValue {
+			t.Fatalf("%v: expected %v bytes, actual: %v", tc.name, 80*SizeOfValue, buf.Len())
+		}
+	}
+}
+
+func TestWriters_FlushDoesNotSync(t *testing.T) {
+	// the writers created by the constructors do not sync the stream unless it is wrapped with SyncWriter
+	testCases := []struct {
+		name  string
+		write func(w WriteSyncer) error
+	}{
+		{"binary_uint64", func(w WriteSyncer) error {
+			return writeAndFlush[uint64](AsWriter(NewBinaryUint64WriterCount(w, 8)), 1)
+		}},
+		{"binary", func(w WriteSyncer) error {
+			return writeAndFlush[int64](NewBinaryWriterCount[int64](w, Int64Codec{}, 8), 1)
+		}},
+		{"record", func(w WriteSyncer) error {
+			return writeAndFlush[[]byte](NewRecordWriterSize(w, 16), []byte("record"))
+		}},
+		{"compressed", func(w WriteSyncer) error {
+			return writeAndFlush[uint64](AsWriter(NewCompressedUint64WriterCount(w, 8, true)), 1)
+		}},
+	}
+
+	for _, tc := range testCases {
+		var buf bufferSyncer
+		if err := tc.write(&buf); err != nil {
+			t.Fatalf("%v: unexpected error: %v", tc.name, err)
+		}
+		if buf.syncs != 0 {
+			t.Fatalf("%v: expected no syncs, actual: %v", tc.name, buf.syncs)
+		}
+		if buf.Len() == 0 {
+			t.Fatalf("%v: expected the data to be written", tc.name)
+		}
+	}
+}
+
+// writeAndFlush writes the value 80 times, flushing the writer after every 10 values
+func writeAndFlush[T any](w Writer[T], x T) error {
+	for i := 0; i < 80; i++ {
+		if err := w.Write(x); err != nil {
+			return err
+		}
+		if i%10 == 9 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestSyncWriter_Pipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	go func() {
+		buf := make([]byte, 100)
+		for {
+			if _, err := r.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	// pipes cannot be synced, which is not an error
+	sw := NewSyncWriter(w, SyncPolicy{Mode: SyncEveryFlush})
+	if _, err := sw.Write([]byte("data")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sw.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSyncPolicy_Validate(t *testing.T) {
+	for _, policy := range []SyncPolicy{{Mode: SyncEveryBytes}, {Mode: SyncMode(-1)}, {Mode: SyncEveryFlush + 1}} {
+		if policy.Validate() == nil {
+			t.Fatalf("expected policy %+v to be invalid", policy)
+		}
+	}
+}
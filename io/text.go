@@ -0,0 +1,205 @@
+package io
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// TextFormat describes the textual representation of values used by TextUint64Reader and TextUint64Writer
+type TextFormat struct {
+	// Delimiter is written after every value
+	Delimiter byte
+	// InputDelimiters separate the values of the input. If empty, the values are separated by Delimiter,
+	// and also by whitespace in the lenient mode, so that the output can be read back in the same format.
+	InputDelimiters string
+	// Strict requires exactly one delimiter after every value (the last one is optional), so that empty values
+	// and any whitespace, which is not a delimiter, are errors.
+	// Otherwise, the values are separated by any number of delimiters and whitespace characters.
+	Strict bool
+	// Signed interprets the values as signed (two's complement) integers
+	Signed bool
+	// Base is 2, 8, 10 or 16
+	Base int
+	// Prefix writes 0b, 0o or 0x before the values in base 2, 8 or 16.
+	// The prefixes are optional in the input regardless of this option.
+	Prefix bool
+}
+
+func DefaultTextFormat() TextFormat {
+	return TextFormat{
+		Delimiter: '\n',
+		Base:      10,
+	}
+}
+
+var ErrInvalidTextFormat = errors.New("invalid text format")
+
+func (f TextFormat) Validate() error {
+	switch f.Base {
+	case 2, 8, 10, 16:
+		return nil
+	default:
+		return ErrInvalidTextFormat
+	}
+}
+
+// separators returns the set of bytes, which separate the values of the input
+func (f TextFormat) separators() *[256]bool {
+	separators := new([256]bool)
+	delimiters := f.InputDelimiters
+	if delimiters == "" {
+		delimiters = string(f.Delimiter)
+	}
+	for i := 0; i < len(delimiters); i++ {
+		separators[delimiters[i]] = true
+	}
+	if !f.Strict {
+		for _, b := range []byte(" \n\t\r\v\f") {
+			separators[b] = true
+		}
+	}
+	return separators
+}
+
+// prefix returns the letter of the prefix of the base or 0 for the base 10
+func (f TextFormat) prefix() byte {
+	switch f.Base {
+	case 2:
+		return 'b'
+	case 8:
+		return 'o'
+	case 16:
+		return 'x'
+	default:
+		return 0
+	}
+}
+
+// appendValue formats the value in the format followed by the delimiter
+func (f TextFormat) appendValue(buf []byte, x uint64) []byte {
+	return append(f.AppendNumber(buf, x), f.Delimiter)
+}
+
+// AppendNumber appends the value formatted in the format without the delimiter
+func (f TextFormat) AppendNumber(buf []byte, x uint64) []byte {
+	if f.Signed && int64(x) < 0 {
+		buf = append(buf, '-')
+		// the negation is correct for math.MinInt64 as well
+		x = -x
+	}
+	if f.Prefix && f.Base != 10 {
+		buf = append(buf, '0', f.prefix())
+	}
+	return strconv.AppendUint(buf, x, f.Base)
+}
+
+var digitValues = func() (values [256]uint8) {
+	for i := range values {
+		values[i] = math.MaxUint8
+	}
+	for b := '0'; b <= '9'; b++ {
+		values[b] = uint8(b - '0')
+	}
+	for b := 'a'; b <= 'f'; b++ {
+		values[b] = uint8(b - 'a' + 10)
+		values[b-'a'+'A'] = uint8(b - 'a' + 10)
+	}
+	return
+}()
+
+// numberParser accumulates the bytes of a number in the given format
+type numberParser struct {
+	base     uint64
+	cutoff   uint64
+	prefix   byte
+	signed   bool
+	value    uint64
+	digits   int
+	negative bool
+	started  bool
+	prefixed bool
+	err      error
+}
+
+func newNumberParser(format TextFormat) numberParser {
+	base := uint64(format.Base)
+	return numberParser{
+		base:   base,
+		cutoff: math.MaxUint64/base + 1,
+		prefix: format.prefix(),
+		signed: format.Signed,
+	}
+}
+
+func (p *numberParser) reset() {
+	p.value = 0
+	p.digits = 0
+	p.negative = false
+	p.started = false
+	p.prefixed = false
+	p.err = nil
+}
+
+func (p *numberParser) add(b byte) {
+	if p.err != nil {
+		return
+	}
+
+	if !p.started {
+		p.started = true
+		if p.signed && (b == '-' || b == '+') {
+			p.negative = b == '-'
+			return
+		}
+	}
+
+	digit := uint64(digitValues[b])
+	if digit >= p.base {
+		// the prefix is only allowed right after the leading zero
+		if p.digits == 1 && p.value == 0 && !p.prefixed && p.prefix != 0 && b|0x20 == p.prefix {
+			p.digits = 0
+			p.prefixed = true
+			return
+		}
+		p.err = strconv.ErrSyntax
+		return
+	}
+
+	// the same check as in strconv.ParseUint, which does not divide for every digit
+	if p.value >= p.cutoff {
+		p.err = strconv.ErrRange
+		return
+	}
+	value := p.value*p.base + digit
+	if value < p.value*p.base {
+		p.err = strconv.ErrRange
+		return
+	}
+	p.value = value
+	p.digits++
+}
+
+// finish returns the parsed value
+func (p *numberParser) finish() (uint64, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	if p.digits == 0 {
+		return 0, strconv.ErrSyntax
+	}
+	if !p.signed {
+		return p.value, nil
+	}
+
+	if p.negative {
+		if p.value > 1<<63 {
+			return 0, strconv.ErrRange
+		}
+		return -p.value, nil
+	}
+	if p.value > math.MaxInt64 {
+		return 0, strconv.ErrRange
+	}
+	return p.value, nil
+}
@@ -0,0 +1,334 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/xosmig/extsort/util"
+	"io"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var _ Uint64Reader = new(TextUint64Reader)
+var _ Uint64Writer = new(TextUint64Writer)
+
+func TestTextUint64Reader_Read(t *testing.T) {
+	input := " 1 22\t333\n\n 18446744073709551615 0\r\n7"
+	r := NewTextUint64ReaderCount(strings.NewReader(input), 1)
+	expected := []uint64{1, 22, 333, 18446744073709551615, 0, 7}
+	if actual := readAllUint64(t, r); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestTextUint64Reader_Empty(t *testing.T) {
+	for _, input := range []string{"", " \n\t "} {
+		r := NewTextUint64ReaderCount(strings.NewReader(input), 1)
+		if _, err := r.ReadUint64(); err != io.EOF {
+			t.Fatalf("input: %q, expected EOF, got: %v", input, err)
+		}
+	}
+}
+
+func TestTextUint64Reader_Errors(t *testing.T) {
+	testCases := []struct {
+		input string
+		line  int
+		token string
+		err   error
+	}{
+		{"1 2 x3 4", 1, "x3", strconv.ErrSyntax},
+		{"1\n2\n\n3a\n", 4, "3a", strconv.ErrSyntax},
+		{"-1", 1, "-1", strconv.ErrSyntax},
+		{"1\n18446744073709551616", 2, "18446744073709551616", strconv.ErrRange},
+		{"99999999999999999999999", 1, "99999999999999999999999", strconv.ErrRange},
+		{strings.Repeat("9", 100), 1, strings.Repeat("9", maxTokenLength), strconv.ErrRange},
+	}
+
+	for _, tc := range testCases {
+		r := NewTextUint64ReaderCount(strings.NewReader(tc.input), 1)
+		var err error
+		for err == nil {
+			_, err = r.ReadUint64()
+		}
+
+		var parseErr *TextParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("input: %q, expected TextParseError, got: %v", tc.input, err)
+		}
+		if parseErr.Line != tc.line || parseErr.Token != tc.token || !errors.Is(err, tc.err) {
+			t.Fatalf("input: %q, unexpected error: %v", tc.input, err)
+		}
+	}
+}
+
+func TestTextUint64IO_WriteAndRead(t *testing.T) {
+	data := []uint64{0, 1, 10, 12345, ^uint64(0)}
+
+	var buf bytes.Buffer
+	w := NewTextUint64WriterCount(&buf, 1)
+	for _, value := range data {
+		if err := w.WriteUint64(value); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	w.Flush()
+	if expected := "0\n1\n10\n12345\n18446744073709551615\n"; buf.String() != expected {
+		t.Fatalf("expected: %q, actual: %q", expected, buf.String())
+	}
+
+	r := NewTextUint64ReaderCount(bytes.NewReader(buf.Bytes()), 1)
+	if actual := readAllUint64(t, r); !reflect.DeepEqual(data, actual) {
+		t.Fatalf("expected: %v, actual: %v", data, actual)
+	}
+}
+
+func writeText(t *testing.T, data []uint64, format TextFormat) string {
+	var buf bytes.Buffer
+	w := NewTextUint64WriterCountFormat(&buf, 1, format)
+	for _, value := range data {
+		if err := w.WriteUint64(value); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return buf.String()
+}
+
+func TestTextUint64IO_Formats(t *testing.T) {
+	data := []uint64{0, 5, 255, 1 << 63, ^uint64(0)}
+
+	testCases := []struct {
+		name     string
+		modify   func(f *TextFormat)
+		expected string
+	}{
+		{"space", func(f *TextFormat) { f.Delimiter = ' ' },
+			"0 5 255 9223372036854775808 18446744073709551615 "},
+		{"comma_strict", func(f *TextFormat) { f.Delimiter = ','; f.Strict = true },
+			"0,5,255,9223372036854775808,18446744073709551615,"},
+		{"comma", func(f *TextFormat) { f.Delimiter = ',' },
+			"0,5,255,9223372036854775808,18446744073709551615,"},
+		{"nul", func(f *TextFormat) { f.Delimiter = 0 },
+			"0\x005\x00255\x009223372036854775808\x0018446744073709551615\x00"},
+		{"signed", func(f *TextFormat) { f.Signed = true },
+			"0\n5\n255\n-9223372036854775808\n-1\n"},
+		{"hex", func(f *TextFormat) { f.Base = 16 },
+			"0\n5\nff\n8000000000000000\nffffffffffffffff\n"},
+		{"hex_prefix_signed", func(f *TextFormat) { f.Base = 16; f.Prefix = true; f.Signed = true },
+			"0x0\n0x5\n0xff\n-0x8000000000000000\n-0x1\n"},
+		{"octal_prefix", func(f *TextFormat) { f.Base = 8; f.Prefix = true },
+			"0o0\n0o5\n0o377\n0o1000000000000000000000\n0o1777777777777777777777\n"},
+		{"binary_strict", func(f *TextFormat) { f.Base = 2; f.Prefix = true; f.Strict = true },
+			"0b0\n0b101\n0b11111111\n0b1" + strings.Repeat("0", 63) + "\n0b" + strings.Repeat("1", 64) + "\n"},
+	}
+
+	for _, tc := range testCases {
+		format := DefaultTextFormat()
+		tc.modify(&format)
+
+		text := writeText(t, data, format)
+		if text != tc.expected {
+			t.Fatalf("%v: expected: %q, actual: %q", tc.name, tc.expected, text)
+		}
+
+		r := NewTextUint64ReaderCountFormat(strings.NewReader(text), 1, format)
+		if actual := readAllUint64(t, r); !reflect.DeepEqual(data, actual) {
+			t.Fatalf("%v: expected: %v, actual: %v", tc.name, data, actual)
+		}
+	}
+}
+
+func TestTextUint64Reader_Formats(t *testing.T) {
+	testCases := []struct {
+		name     string
+		modify   func(f *TextFormat)
+		input    string
+		expected []uint64
+	}{
+		{"optional_prefix", func(f *TextFormat) { f.Base = 16 }, "0xA 0XbC 10 0", []uint64{10, 188, 16, 0}},
+		{"signed_plus", func(f *TextFormat) { f.Signed = true }, "+7 -7", []uint64{7, ^uint64(6)}},
+		{"lenient_delimiters", func(f *TextFormat) { f.InputDelimiters = ",;" }, "1, 2;;3\n,4", []uint64{1, 2, 3, 4}},
+		{"lenient_output_delimiter", func(f *TextFormat) { f.Delimiter = ';' }, "1; 2;;3\n", []uint64{1, 2, 3}},
+		{"strict_no_trailing", func(f *TextFormat) { f.Strict = true }, "1\n2", []uint64{1, 2}},
+		{"strict_delimiters", func(f *TextFormat) { f.Strict = true; f.InputDelimiters = ",\n" }, "1,2\n3",
+			[]uint64{1, 2, 3}},
+	}
+
+	for _, tc := range testCases {
+		format := DefaultTextFormat()
+		tc.modify(&format)
+		r := NewTextUint64ReaderCountFormat(strings.NewReader(tc.input), 1, format)
+		if actual := readAllUint64(t, r); !reflect.DeepEqual(tc.expected, actual) {
+			t.Fatalf("%v: expected: %v, actual: %v", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestTextUint64Reader_FormatErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(f *TextFormat)
+		input  string
+		line   int
+		token  string
+		err    error
+	}{
+		{"strict_empty", func(f *TextFormat) { f.Strict = true }, "1\n\n2", 2, "", strconv.ErrSyntax},
+		{"strict_space", func(f *TextFormat) { f.Strict = true }, "1\n 2\n", 2, " 2", strconv.ErrSyntax},
+		{"signed_overflow", func(f *TextFormat) { f.Signed = true }, "9223372036854775808", 1,
+			"9223372036854775808", strconv.ErrRange},
+		{"signed_underflow", func(f *TextFormat) { f.Signed = true }, "-9223372036854775809", 1,
+			"-9223372036854775809", strconv.ErrRange},
+		{"unsigned_minus", func(f *TextFormat) {}, "-1", 1, "-1", strconv.ErrSyntax},
+		{"only_prefix", func(f *TextFormat) { f.Base = 16 }, "0x", 1, "0x", strconv.ErrSyntax},
+		{"double_prefix", func(f *TextFormat) { f.Base = 16 }, "0x0x1", 1, "0x0x1", strconv.ErrSyntax},
+		{"wrong_prefix", func(f *TextFormat) { f.Base = 8 }, "0x1", 1, "0x1", strconv.ErrSyntax},
+		{"only_sign", func(f *TextFormat) { f.Signed = true }, "-", 1, "-", strconv.ErrSyntax},
+		{"binary_digit", func(f *TextFormat) { f.Base = 2 }, "102", 1, "102", strconv.ErrSyntax},
+		{"hex_overflow", func(f *TextFormat) { f.Base = 16 }, "10000000000000000", 1, "10000000000000000",
+			strconv.ErrRange},
+	}
+
+	for _, tc := range testCases {
+		format := DefaultTextFormat()
+		tc.modify(&format)
+		r := NewTextUint64ReaderCountFormat(strings.NewReader(tc.input), 1, format)
+		var err error
+		for err == nil {
+			_, err = r.ReadUint64()
+		}
+
+		var parseErr *TextParseError
+		if !errors.As(err, &parseErr) || parseErr.Line != tc.line || parseErr.Token != tc.token ||
+			!errors.Is(err, tc.err) {
+			t.Fatalf("%v: unexpected error: %v", tc.name, err)
+		}
+	}
+}
+
+func TestTextFormat_AppendNumber(t *testing.T) {
+	format := DefaultTextFormat()
+	format.Base = 16
+	format.Prefix = true
+	format.Signed = true
+	if actual := string(format.AppendNumber([]byte("value: "), ^uint64(254))); actual != "value: -0xff" {
+		t.Fatalf("expected: %q, actual: %q", "value: -0xff", actual)
+	}
+}
+
+func TestTextUint64Writer_NoAllocations(t *testing.T) {
+	w := NewTextUint64WriterCount(io.Discard, DefaultBufValuesCount)
+	allocs := testing.AllocsPerRun(1000, func() {
+		w.WriteUint64(rand.Uint64())
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, actual: %v", allocs)
+	}
+}
+
+func TestTextValueCountWriter(t *testing.T) {
+	var buf bytes.Buffer
+	format := DefaultTextFormat()
+	format.Signed = true
+	format.Base = 16
+	w := NewTextValueCountWriterCountFormat(&buf, 1, format)
+	for _, x := range []ValueCount{{0, 1}, {^uint64(0), 3}, {255, 12}} {
+		if err := w.Write(x); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "0 1\n-1 3\nff 12\n"
+	if buf.String() != expected {
+		t.Fatalf("expected: %q, actual: %q", expected, buf.String())
+	}
+}
+
+// fmtTextUint64Reader and fmtTextUint64Writer are the former implementations based on fmt and strconv,
+// which are kept to compare the performance
+
+type fmtTextUint64Reader struct{ stream *bufio.Reader }
+
+func (r fmtTextUint64Reader) ReadUint64() (uint64, error) {
+	var value uint64
+	_, err := fmt.Fscanf(r.stream, "%d", &value)
+	return value, err
+}
+
+func (r fmtTextUint64Reader) SetProfiler(p *util.SimpleProfiler) {}
+
+type fmtTextUint64Writer struct{ stream *bufio.Writer }
+
+func (w fmtTextUint64Writer) WriteUint64(x uint64) error {
+	byteBuf := make([]byte, 0, 30)
+	_, err := w.stream.Write(strconv.AppendUint(byteBuf, x, 10))
+	return err
+}
+
+func (w fmtTextUint64Writer) Flush() error {
+	return w.stream.Flush()
+}
+
+func (w fmtTextUint64Writer) SetProfiler(p *util.SimpleProfiler) {}
+
+func generateTextInput(count int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < count; i++ {
+		buf.WriteString(strconv.FormatUint(rand.Uint64(), 10))
+		buf.WriteByte(' ')
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkTextUint64Reader(b *testing.B) {
+	const count = 100000
+	input := generateTextInput(count)
+
+	readers := map[string]func(r io.Reader) Uint64Reader{
+		"parser": func(r io.Reader) Uint64Reader { return NewTextUint64ReaderCount(r, DefaultBufValuesCount) },
+		"fmt": func(r io.Reader) Uint64Reader {
+			return fmtTextUint64Reader{bufio.NewReaderSize(r, DefaultBufValuesCount*SizeOfValue)}
+		},
+	}
+	for _, name := range []string{"parser", "fmt"} {
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for n := 0; n < b.N; n++ {
+				r := readers[name](bytes.NewReader(input))
+				for i := 0; i < count; i++ {
+					if _, err := r.ReadUint64(); err != nil {
+						b.Fatalf("unexpected error: %v", err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTextUint64Writer(b *testing.B) {
+	writers := map[string]Uint64Writer{
+		"writer": NewTextUint64WriterCount(io.Discard, DefaultBufValuesCount),
+		"fmt":    fmtTextUint64Writer{bufio.NewWriterSize(io.Discard, DefaultBufValuesCount*SizeOfValue)},
+	}
+	for _, name := range []string{"writer", "fmt"} {
+		b.Run(name, func(b *testing.B) {
+			w := writers[name]
+			b.SetBytes(SizeOfValue)
+			for n := 0; n < b.N; n++ {
+				w.WriteUint64(rand.Uint64())
+			}
+			w.Flush()
+		})
+	}
+}
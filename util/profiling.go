@@ -18,6 +18,9 @@ type SimpleProfiler struct {
 
 	totalMeasuredDuration time.Duration
 	totalRunningDuration  time.Duration
+
+	uncompressedBytes int64
+	compressedBytes   int64
 }
 
 func NewSimpleProfiler() *SimpleProfiler {
@@ -59,11 +62,11 @@ func (p *SimpleProfiler) StartMeasuring() {
 }
 
 func (p *SimpleProfiler) FinishMeasuring() {
-	measuredDuration := time.Since(p.currentMeasureStart)
-
+	// the nil profiler does not read the clock, since it is called for every value
 	if p.state == stateNilProfiler {
 		return
 	}
+	measuredDuration := time.Since(p.currentMeasureStart)
 
 	if p.state != stateMeasuring {
 		panic("Invalid state")
@@ -112,6 +115,26 @@ func (p *SimpleProfiler) GetMeasuredDurationRatio() float64 {
 	return float64(p.totalMeasuredDuration.Nanoseconds()) / float64(p.totalRunningDuration.Nanoseconds())
 }
 
+// AddCompressed accounts a block of data, which took compressedSize bytes instead of size bytes
+func (p *SimpleProfiler) AddCompressed(size, compressedSize int) {
+	if p.state == stateNilProfiler {
+		return
+	}
+
+	p.uncompressedBytes += int64(size)
+	p.compressedBytes += int64(compressedSize)
+}
+
+// GetCompressionRatio returns the ratio of the size of the data to its compressed size
+// or 0 if no data has been compressed
+func (p *SimpleProfiler) GetCompressionRatio() float64 {
+	if p.compressedBytes == 0 {
+		return 0
+	}
+
+	return float64(p.uncompressedBytes) / float64(p.compressedBytes)
+}
+
 func (p *SimpleProfiler) IsNilProfiler() bool {
 	return p.state == stateNilProfiler
 }
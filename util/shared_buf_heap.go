@@ -126,3 +126,125 @@ func (h rightHeap) HInit() {
 func (h rightHeap) MinValue() uint64 {
 	return h.data[h.dataIdx(0)]
 }
+
+// SharedBufHeapOf is a generic counterpart of SharedBufHeap ordered by an arbitrary less function.
+type SharedBufHeapOf[T any] interface {
+	ArrayPush(T)
+	HInit()
+	HPush(T)
+	HPop() T
+	Len() int
+	Cap() int
+	MinValue() T
+}
+
+func NewSharedBufHeapFunc[T any](size int, less func(a, b T) bool) (SharedBufHeapOf[T], SharedBufHeapOf[T]) {
+	heapData := &heapDataOf[T]{
+		data: make([]T, size, size),
+		less: less,
+	}
+	return &sideHeap[T]{heapDataOf: heapData, right: false}, &sideHeap[T]{heapDataOf: heapData, right: true}
+}
+
+type heapDataOf[T any] struct {
+	data      []T
+	leftSize  int
+	rightSize int
+	less      func(a, b T) bool
+}
+
+func (h *heapDataOf[T]) Cap() int {
+	return len(h.data) - h.leftSize - h.rightSize
+}
+
+// sideHeap is a heap stored either at the beginning (left) or at the end (right) of the shared buffer
+type sideHeap[T any] struct {
+	*heapDataOf[T]
+	right bool
+}
+
+func (h *sideHeap[T]) dataIdx(i int) int {
+	if h.right {
+		return len(h.data) - 1 - i
+	}
+	return i
+}
+
+func (h *sideHeap[T]) size() *int {
+	if h.right {
+		return &h.rightSize
+	}
+	return &h.leftSize
+}
+
+func (h *sideHeap[T]) Len() int {
+	return *h.size()
+}
+
+func (h *sideHeap[T]) lessIdx(i, j int) bool {
+	return h.less(h.data[h.dataIdx(i)], h.data[h.dataIdx(j)])
+}
+
+func (h *sideHeap[T]) swap(i, j int) {
+	i, j = h.dataIdx(i), h.dataIdx(j)
+	h.data[i], h.data[j] = h.data[j], h.data[i]
+}
+
+func (h *sideHeap[T]) up(j int) {
+	for {
+		i := (j - 1) / 2 // parent
+		if i == j || !h.lessIdx(j, i) {
+			break
+		}
+		h.swap(i, j)
+		j = i
+	}
+}
+
+func (h *sideHeap[T]) down(i, n int) {
+	for {
+		j1 := 2*i + 1
+		if j1 >= n || j1 < 0 { // j1 < 0 after int overflow
+			break
+		}
+		j := j1 // left child
+		if j2 := j1 + 1; j2 < n && h.lessIdx(j2, j1) {
+			j = j2 // = 2*i + 2  // right child
+		}
+		if !h.lessIdx(j, i) {
+			break
+		}
+		h.swap(i, j)
+		i = j
+	}
+}
+
+func (h *sideHeap[T]) ArrayPush(x T) {
+	size := h.size()
+	h.data[h.dataIdx(*size)] = x
+	*size++
+}
+
+func (h *sideHeap[T]) HInit() {
+	n := h.Len()
+	for i := n/2 - 1; i >= 0; i-- {
+		h.down(i, n)
+	}
+}
+
+func (h *sideHeap[T]) HPush(x T) {
+	h.ArrayPush(x)
+	h.up(h.Len() - 1)
+}
+
+func (h *sideHeap[T]) HPop() T {
+	n := h.Len() - 1
+	h.swap(0, n)
+	h.down(0, n)
+	*h.size()--
+	return h.data[h.dataIdx(n)]
+}
+
+func (h *sideHeap[T]) MinValue() T {
+	return h.data[h.dataIdx(0)]
+}
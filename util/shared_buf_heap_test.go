@@ -63,3 +63,12 @@ func BenchmarkNewSharedBufHeap_10M(b *testing.B) {
 		}
 	}
 }
+
+func TestSharedBufHeapFunc_HeapSort(t *testing.T) {
+	items := []uint64{1, 7, 2, 5, 5, 12, 2, 4}
+	less := func(a, b uint64) bool { return a < b }
+
+	leftHeap, rightHeap := NewSharedBufHeapFunc(2*len(items), less)
+	testHeapSort(t, leftHeap, items)
+	testHeapSort(t, rightHeap, items)
+}